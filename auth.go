@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// role is the access level of an admin API request.
+type role int
+
+const (
+	roleNone  role = iota
+	roleRead       // may read health, records, changes and events
+	roleAdmin      // may additionally trigger polls
+)
+
+// authEnabled reports whether any admin API credentials are configured.
+// Without credentials every request is granted the admin role, or with
+// client certificate verification every request presenting a valid one.
+func (h *HealthServer) authEnabled() bool {
+	c := h.cfg
+	return c.AdminToken.IsSet() || c.AdminUser != "" || c.ReadToken.IsSet() || c.ReadUser != ""
+}
+
+// authRole returns the role granted by the credentials of r. When client
+// certificates are verified, requests without a valid one get no role.
+func (h *HealthServer) authRole(r *http.Request) role {
+	if h.certs != nil && h.certs.VerifiesClients() && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return roleNone
+	}
+	if !h.authEnabled() {
+		return roleAdmin
+	}
+	c := h.cfg
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		switch {
+		case secretEqual(token, c.AdminToken.Value()):
+			return roleAdmin
+		case secretEqual(token, c.ReadToken.Value()):
+			return roleRead
+		}
+		return roleNone
+	}
+	if user, pass, ok := r.BasicAuth(); ok {
+		switch {
+		case secretEqual(user, c.AdminUser) && secretEqual(pass, c.AdminPassword.Value()):
+			return roleAdmin
+		case secretEqual(user, c.ReadUser) && secretEqual(pass, c.ReadPassword.Value()):
+			return roleRead
+		}
+	}
+	return roleNone
+}
+
+// require wraps next so that it is only served to requests granted at least
+// the given role. Requests without valid credentials get 401, requests with
+// a lower role 403.
+func (h *HealthServer) require(min role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch got := h.authRole(r); {
+		case got >= min:
+			next(w, r)
+		case got == roleNone:
+			if h.cfg.AdminUser != "" || h.cfg.ReadUser != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="pangolin-dns"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="pangolin-dns"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}
+}
+
+// secretEqual compares a presented credential with a configured one in
+// constant time. An unset credential never matches.
+func secretEqual(got, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
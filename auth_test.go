@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newAuthTestServer(anonymousHealth bool, adminAddr string) *HealthServer {
+	cfg := newTestConfig("")
+	cfg.AdminToken = NewSecret("admin-token")
+	cfg.ReadToken = NewSecret("read-token")
+	cfg.AdminUser, cfg.AdminPassword = "admin", NewSecret("admin-pass")
+	cfg.ReadUser, cfg.ReadPassword = "viewer", NewSecret("viewer-pass")
+	cfg.HealthAnonymous = anonymousHealth
+	cfg.AdminAddr = adminAddr
+	return NewHealthServer(cfg, nil, NewRecordStore())
+}
+
+func TestAuth_Roles(t *testing.T) {
+	h := newAuthTestServer(true, "")
+	_, admin := h.routes()
+
+	tests := []struct {
+		name         string
+		method, path string
+		auth         func(*http.Request)
+		want         int
+	}{
+		{"anonymous healthz", http.MethodGet, "/healthz", nil, http.StatusOK},
+		{"anonymous domains", http.MethodGet, "/domains", nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/domains", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"read token domains", http.MethodGet, "/domains", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusOK},
+		{"read token poll", http.MethodPost, "/poll", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-token") }, http.StatusForbidden},
+		{"admin token poll", http.MethodPost, "/poll", func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin-token") }, http.StatusOK},
+		{"read basic changes", http.MethodGet, "/changes", func(r *http.Request) { r.SetBasicAuth("viewer", "viewer-pass") }, http.StatusOK},
+		{"read basic poll", http.MethodPost, "/poll", func(r *http.Request) { r.SetBasicAuth("viewer", "viewer-pass") }, http.StatusForbidden},
+		{"admin basic poll", http.MethodPost, "/poll", func(r *http.Request) { r.SetBasicAuth("admin", "admin-pass") }, http.StatusOK},
+		{"wrong password", http.MethodGet, "/domains", func(r *http.Request) { r.SetBasicAuth("admin", "viewer-pass") }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.auth != nil {
+			tt.auth(req)
+		}
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestAuth_UnauthorizedChallengesBasic(t *testing.T) {
+	h := newAuthTestServer(true, "")
+	_, admin := h.routes()
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/domains", nil))
+	if got := rec.Header().Get("WWW-Authenticate"); got != `Basic realm="pangolin-dns"` {
+		t.Errorf("unexpected challenge %q", got)
+	}
+}
+
+func TestAuth_HealthRequiresReadUnlessAnonymous(t *testing.T) {
+	h := newAuthTestServer(false, "")
+	probe, _ := h.routes()
+
+	rec := httptest.NewRecorder()
+	probe.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for anonymous /healthz, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Authorization", "Bearer read-token")
+	rec = httptest.NewRecorder()
+	probe.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for /healthz with read token, got %d", rec.Code)
+	}
+}
+
+func TestAuth_SeparateAdminAddr(t *testing.T) {
+	h := newAuthTestServer(true, "127.0.0.1:0")
+	probe, admin := h.routes()
+
+	rec := httptest.NewRecorder()
+	probe.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/domains", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected the probe server not to serve /domains, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/domains", nil)
+	req.Header.Set("Authorization", "Bearer read-token")
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the admin server to serve /domains, got %d", rec.Code)
+	}
+}
+
+func TestAuth_DisabledWithoutCredentials(t *testing.T) {
+	h := NewHealthServer(newTestConfig(""), nil, NewRecordStore())
+	_, admin := h.routes()
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/poll", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected /poll to be open without credentials, got %d", rec.Code)
+	}
+}
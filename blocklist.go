@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Responses to queries for blocked names.
+const (
+	BlockNXDomain = "nxdomain" // the name does not exist
+	BlockNull     = "null"     // 0.0.0.0 for A, :: for AAAA, no records otherwise
+	BlockRefused  = "refused"  // the query is refused
+)
+
+// defaultClientGroup labels the blocked-query counter of clients outside all
+// client groups.
+const defaultClientGroup = "default"
+
+// ClientGroup is a set of client networks with its own blocking setting.
+type ClientGroup struct {
+	Name     string
+	Networks []netip.Prefix
+	Blocking bool
+}
+
+// Blocker answers queries for names on blocklists instead of forwarding
+// them. Blocklists are hosts-format or domain-list files, read from disk or
+// downloaded, and refreshed periodically; a source that fails to load keeps
+// its previous domains. A listed domain blocks all names below it, unless
+// one of them is on the allowlist. Whether a client is subject to blocking
+// depends on the first client group containing its address.
+type Blocker struct {
+	sources  []string // URLs or file paths
+	allow    map[string]bool
+	response string
+	groups   []ClientGroup
+	blocking bool // for clients outside all groups
+	refresh  time.Duration
+	retry    RetryPolicy
+	client   *http.Client
+
+	domains atomic.Pointer[map[string]bool] // merged blocked domains of all sources
+	blocked map[string]*atomic.Int64        // client group → blocked queries
+
+	mu    sync.Mutex
+	lists map[string]*blocklistState // source → its last load
+}
+
+type blocklistState struct {
+	domains  map[string]bool
+	lastLoad time.Time // of the last successful load
+	err      string    // of the last load, if it failed
+}
+
+// BlocklistStatus reports the blocklists and blocked queries.
+type BlocklistStatus struct {
+	Domains int                     `json:"domains"`
+	Sources []BlocklistSourceStatus `json:"sources"`
+	Blocked map[string]int64        `json:"blocked"` // client group → blocked queries
+}
+
+// BlocklistSourceStatus reports the last load of one blocklist.
+type BlocklistSourceStatus struct {
+	Source    string `json:"source"`
+	Domains   int    `json:"domains"`
+	LastLoad  string `json:"last_load,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func NewBlocker(cfg *Config) *Blocker {
+	b := &Blocker{
+		sources:  cfg.Blocklists,
+		allow:    make(map[string]bool),
+		response: cfg.BlockResponse,
+		groups:   cfg.ClientGroups,
+		blocking: cfg.Blocking,
+		refresh:  cfg.BlocklistRefresh,
+		retry:    cfg.APIRetry,
+		client: &http.Client{
+			Timeout: time.Minute,
+		},
+		blocked: map[string]*atomic.Int64{defaultClientGroup: new(atomic.Int64)},
+		lists:   make(map[string]*blocklistState),
+	}
+	for _, domain := range cfg.Allowlist {
+		b.allow[normalizeName(domain)] = true
+	}
+	for _, g := range cfg.ClientGroups {
+		b.blocked[g.Name] = new(atomic.Int64)
+	}
+	b.domains.Store(&map[string]bool{})
+	return b
+}
+
+// Run loads all blocklists immediately, then every refresh interval until
+// ctx is cancelled.
+func (b *Blocker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.refresh)
+	defer ticker.Stop()
+	for {
+		b.Load(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Load reloads all blocklists and swaps in the merged domains.
+func (b *Blocker) Load(ctx context.Context) {
+	for _, src := range b.sources {
+		domains, err := b.load(ctx, src)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.mu.Lock()
+		st := b.lists[src]
+		if st == nil {
+			st = &blocklistState{}
+			b.lists[src] = st
+		}
+		if err != nil {
+			log.Printf("blocklist: %s: %v; keeping %d previous domain(s)", src, err, len(st.domains))
+			st.err = err.Error()
+		} else {
+			log.Printf("blocklist: %s: loaded %d domain(s)", src, len(domains))
+			st.domains, st.lastLoad, st.err = domains, time.Now(), ""
+		}
+		b.mu.Unlock()
+	}
+
+	b.mu.Lock()
+	merged := make(map[string]bool)
+	for _, st := range b.lists {
+		for d := range st.domains {
+			merged[d] = true
+		}
+	}
+	b.mu.Unlock()
+	b.domains.Store(&merged)
+	log.Printf("blocklist: blocking %d domain(s) from %d list(s)", len(merged), len(b.sources))
+}
+
+// load reads a blocklist from a URL or file and parses it.
+func (b *Blocker) load(ctx context.Context, src string) (map[string]bool, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		return parseBlocklist(data)
+	}
+
+	var data []byte
+	err := b.retry.Do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", src, nil)
+		if err != nil {
+			return err
+		}
+		data, err = doRequest(b.client, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseBlocklist(data)
+}
+
+// parseBlocklist parses a hosts-format file ("0.0.0.0 ads.example.com") or a
+// domain list (one domain per line), or a mix of both. Comments starting
+// with "#", names without a dot such as "localhost", and invalid names are
+// ignored.
+func parseBlocklist(data []byte) (map[string]bool, error) {
+	domains := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			fields = fields[1:] // hosts format: address, then names
+		} else if len(fields) != 1 {
+			continue
+		}
+		for _, name := range fields {
+			name = strings.TrimPrefix(name, "*.")
+			if !strings.Contains(strings.Trim(name, "."), ".") || name == "localhost.localdomain" {
+				continue
+			}
+			if _, ok := dns.IsDomainName(name); !ok || net.ParseIP(name) != nil {
+				continue
+			}
+			domains[normalizeName(name)] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("parse blocklist: %w", err)
+	}
+	return domains, nil
+}
+
+// Blocked reports whether a query for name from client is blocked, along
+// with the client group deciding it. Blocked queries are counted per group.
+func (b *Blocker) Blocked(name string, client netip.Addr) (group string, blocked bool) {
+	if b == nil {
+		return "", false
+	}
+
+	group, enabled := defaultClientGroup, b.blocking
+	client = client.Unmap()
+	for _, g := range b.groups {
+		if containsAddr(g.Networks, client) {
+			group, enabled = g.Name, g.Blocking
+			break
+		}
+	}
+	if !enabled {
+		return group, false
+	}
+
+	domains := *b.domains.Load()
+	name = normalizeName(name)
+	for suffix := name; suffix != ""; {
+		if b.allow[suffix] {
+			return group, false
+		}
+		if domains[suffix] {
+			blocked = true
+		}
+		_, rest, ok := strings.Cut(suffix, ".")
+		if !ok || rest == "" {
+			break
+		}
+		suffix = rest
+	}
+	if blocked {
+		b.blocked[group].Add(1)
+	}
+	return group, blocked
+}
+
+func containsAddr(networks []netip.Prefix, addr netip.Addr) bool {
+	for _, n := range networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Response returns the answer to a blocked query r.
+func (b *Blocker) Response(r *dns.Msg) *dns.Msg {
+	msg := new(dns.Msg)
+	switch b.response {
+	case BlockRefused:
+		return msg.SetRcode(r, dns.RcodeRefused)
+	case BlockNull:
+		msg.SetReply(r)
+		msg.Authoritative = true
+		q := r.Question[0]
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch q.Qtype {
+		case dns.TypeA:
+			msg.Answer = append(msg.Answer, &dns.A{Hdr: hdr, A: net.IPv4zero})
+		case dns.TypeAAAA:
+			msg.Answer = append(msg.Answer, &dns.AAAA{Hdr: hdr, AAAA: net.IPv6zero})
+		}
+		return msg
+	default:
+		msg.SetRcode(r, dns.RcodeNameError)
+		msg.Authoritative = true
+		return msg
+	}
+}
+
+// Status returns the state of all blocklists and the blocked-query counters.
+func (b *Blocker) Status() *BlocklistStatus {
+	if b == nil {
+		return nil
+	}
+	st := &BlocklistStatus{
+		Domains: len(*b.domains.Load()),
+		Sources: make([]BlocklistSourceStatus, 0, len(b.sources)),
+		Blocked: make(map[string]int64, len(b.blocked)),
+	}
+
+	b.mu.Lock()
+	for _, src := range b.sources {
+		ss := BlocklistSourceStatus{Source: src}
+		if l := b.lists[src]; l != nil {
+			ss.Domains = len(l.domains)
+			ss.LastError = l.err
+			if !l.lastLoad.IsZero() {
+				ss.LastLoad = l.lastLoad.UTC().Format(time.RFC3339)
+			}
+		}
+		st.Sources = append(st.Sources, ss)
+	}
+	b.mu.Unlock()
+
+	for group, n := range b.blocked {
+		st.Blocked[group] = n.Load()
+	}
+	return st
+}
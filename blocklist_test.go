@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func newTestBlocker(domains ...string) *Blocker {
+	b := NewBlocker(&Config{BlockResponse: BlockNXDomain, Blocking: true})
+	list := make(map[string]bool)
+	for _, d := range domains {
+		list[normalizeName(d)] = true
+	}
+	b.domains.Store(&list)
+	return b
+}
+
+func TestParseBlocklist(t *testing.T) {
+	data := []byte(`# hosts format
+127.0.0.1 localhost
+0.0.0.0 ads.example.com tracker.example.com # trailing comment
+::1 ip6-localhost
+# domain list
+Metrics.Example.NET.
+*.wild.example.org
+not a domain line
+192.0.2.1
+`)
+	domains, err := parseBlocklist(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"ads.example.com.", "tracker.example.com.", "metrics.example.net.", "wild.example.org."}
+	if len(domains) != len(want) {
+		t.Errorf("expected %d domains, got %v", len(want), domains)
+	}
+	for _, d := range want {
+		if !domains[d] {
+			t.Errorf("expected %s to be blocked, got %v", d, domains)
+		}
+	}
+}
+
+func TestBlocker_Blocked(t *testing.T) {
+	b := newTestBlocker("ads.example.com", "example.net")
+	b.allow["cdn.example.net."] = true
+	client := netip.MustParseAddr("192.168.1.10")
+
+	tests := []struct {
+		name    string
+		blocked bool
+	}{
+		{"ads.example.com.", true},
+		{"ADS.example.com", true},
+		{"x.ads.example.com.", true},
+		{"example.com.", false},
+		{"www.example.net.", true},
+		{"cdn.example.net.", false},
+		{"img.cdn.example.net.", false},
+		{"example.org.", false},
+	}
+	for _, tt := range tests {
+		if _, blocked := b.Blocked(tt.name, client); blocked != tt.blocked {
+			t.Errorf("Blocked(%q) = %v, want %v", tt.name, blocked, tt.blocked)
+		}
+	}
+	if n := b.Status().Blocked[defaultClientGroup]; n != 4 {
+		t.Errorf("expected 4 blocked queries, got %d", n)
+	}
+}
+
+func TestBlocker_ClientGroups(t *testing.T) {
+	b := NewBlocker(&Config{
+		Blocking: false,
+		ClientGroups: []ClientGroup{
+			{Name: "kids", Networks: []netip.Prefix{netip.MustParsePrefix("192.168.10.0/24")}, Blocking: true},
+			{Name: "all", Networks: []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")}, Blocking: false},
+		},
+	})
+	b.domains.Store(&map[string]bool{"ads.example.com.": true})
+
+	tests := []struct {
+		client  string
+		group   string
+		blocked bool
+	}{
+		{"192.168.10.5", "kids", true},
+		{"::ffff:192.168.10.5", "kids", true},
+		{"192.168.20.5", "all", false},
+		{"10.0.0.5", defaultClientGroup, false},
+	}
+	for _, tt := range tests {
+		group, blocked := b.Blocked("ads.example.com.", netip.MustParseAddr(tt.client))
+		if group != tt.group || blocked != tt.blocked {
+			t.Errorf("Blocked from %s = %s, %v, want %s, %v", tt.client, group, blocked, tt.group, tt.blocked)
+		}
+	}
+	st := b.Status()
+	if st.Blocked["kids"] != 2 || st.Blocked["all"] != 0 || st.Blocked[defaultClientGroup] != 0 {
+		t.Errorf("unexpected counters %v", st.Blocked)
+	}
+}
+
+func TestBlocker_Response(t *testing.T) {
+	tests := []struct {
+		response string
+		qtype    uint16
+		rcode    int
+		answer   string
+	}{
+		{BlockNXDomain, dns.TypeA, dns.RcodeNameError, ""},
+		{BlockRefused, dns.TypeA, dns.RcodeRefused, ""},
+		{BlockNull, dns.TypeA, dns.RcodeSuccess, "0.0.0.0"},
+		{BlockNull, dns.TypeAAAA, dns.RcodeSuccess, "::"},
+		{BlockNull, dns.TypeMX, dns.RcodeSuccess, ""},
+	}
+	for _, tt := range tests {
+		b := NewBlocker(&Config{BlockResponse: tt.response})
+		resp := b.Response(makeQuery("ads.example.com", tt.qtype))
+		if resp.Rcode != tt.rcode {
+			t.Errorf("%s/%s: expected rcode %d, got %d", tt.response, dns.TypeToString[tt.qtype], tt.rcode, resp.Rcode)
+		}
+		var answer string
+		if len(resp.Answer) == 1 {
+			switch rr := resp.Answer[0].(type) {
+			case *dns.A:
+				answer = rr.A.String()
+			case *dns.AAAA:
+				answer = rr.AAAA.String()
+			}
+		} else if len(resp.Answer) > 1 {
+			t.Errorf("%s/%s: expected at most 1 answer, got %v", tt.response, dns.TypeToString[tt.qtype], resp.Answer)
+		}
+		if answer != tt.answer {
+			t.Errorf("%s/%s: expected answer %q, got %q", tt.response, dns.TypeToString[tt.qtype], tt.answer, answer)
+		}
+	}
+}
+
+func TestBlocker_LoadKeepsPreviousOnFailure(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(file, []byte("ads.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("0.0.0.0 tracker.example.net\n"))
+	}))
+	defer srv.Close()
+
+	b := NewBlocker(&Config{Blocklists: []string{file, srv.URL}, Blocking: true})
+	b.Load(context.Background())
+	st := b.Status()
+	if st.Domains != 2 || st.Sources[0].Domains != 1 || st.Sources[1].Domains != 1 || st.Sources[1].LastLoad == "" {
+		t.Fatalf("unexpected status after first load %+v", st)
+	}
+
+	fail = true
+	os.Remove(file)
+	b.Load(context.Background())
+	st = b.Status()
+	if st.Domains != 2 {
+		t.Errorf("expected previous domains to be kept, got %d", st.Domains)
+	}
+	for _, src := range st.Sources {
+		if src.LastError == "" || src.Domains != 1 {
+			t.Errorf("expected an error and the previous domain for %s, got %+v", src.Source, src)
+		}
+	}
+	if _, blocked := b.Blocked("tracker.example.net.", netip.Addr{}); !blocked {
+		t.Error("expected tracker.example.net to stay blocked")
+	}
+}
+
+func TestDNSServer_Blocklist(t *testing.T) {
+	srv := newTestDNSServer(map[string]string{
+		"ads.example.com.": "10.0.0.5",
+	})
+	srv.UseBlocker(newTestBlocker("example.com"))
+
+	// Local names take precedence over blocklists.
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("ads.example.com", dns.TypeA))
+	if w.msg == nil || len(w.msg.Answer) != 1 || !w.msg.Answer[0].(*dns.A).A.Equal(net.ParseIP("10.0.0.5")) {
+		t.Fatalf("expected the local record, got %v", w.msg)
+	}
+
+	w = &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("tracker.example.com", dns.TypeA))
+	if w.msg == nil || w.msg.Rcode != dns.RcodeNameError || !w.msg.Authoritative {
+		t.Errorf("expected authoritative NXDOMAIN, got %v", w.msg)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CaddySource discovers the hostnames matched by the routes of a Caddy
+// instance via its admin API (/config/) and maps them to the instance's
+// local IP.
+type CaddySource struct {
+	inst   ProxyInstance
+	client *http.Client
+}
+
+func NewCaddySource(inst ProxyInstance) *CaddySource {
+	return &CaddySource{
+		inst: inst,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (c *CaddySource) Name() string { return "caddy:" + c.inst.Name }
+
+// Fetch returns one record per hostname found in a host matcher anywhere in
+// the running config, including subroutes.
+func (c *CaddySource) Fetch(ctx context.Context) ([]Record, error) {
+	url := strings.TrimRight(c.inst.APIURL, "/") + "/config/"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := doRequest(c.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("GET /config/: %w", err)
+	}
+
+	var config any
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	hosts := make(map[string]bool)
+	collectCaddyHosts(config, hosts)
+
+	names := make([]string, 0, len(hosts))
+	for h := range hosts {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+
+	records := make([]Record, 0, len(names))
+	for _, h := range names {
+		records = append(records, Record{Name: h, IP: c.inst.LocalIP})
+	}
+	return records, nil
+}
+
+// collectCaddyHosts walks a Caddy JSON config and adds the hostnames of all
+// "host" matchers to hosts. Wildcard and placeholder hosts are skipped.
+func collectCaddyHosts(node any, hosts map[string]bool) {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if key == "match" {
+				for _, set := range asSlice(child) {
+					m, ok := set.(map[string]any)
+					if !ok {
+						continue
+					}
+					for _, h := range asSlice(m["host"]) {
+						if s, ok := h.(string); ok && s != "" && !strings.ContainsAny(s, "*{") {
+							hosts[s] = true
+						}
+					}
+				}
+			}
+			collectCaddyHosts(child, hosts)
+		}
+	case []any:
+		for _, child := range v {
+			collectCaddyHosts(child, hosts)
+		}
+	}
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
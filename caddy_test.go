@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testCaddyConfig = `{
+  "apps": {
+    "http": {
+      "servers": {
+        "srv0": {
+          "listen": [":443"],
+          "routes": [
+            {
+              "match": [{"host": ["app.example.com", "www.example.com"]}],
+              "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "10.0.0.20:8080"}]}]
+            },
+            {
+              "match": [{"host": ["*.wild.example.com"]}],
+              "handle": [{
+                "handler": "subroute",
+                "routes": [{"match": [{"host": ["nested.example.com"]}]}]
+              }]
+            }
+          ]
+        }
+      }
+    }
+  }
+}`
+
+func TestCaddySource_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testCaddyConfig))
+	}))
+	defer srv.Close()
+
+	src := NewCaddySource(ProxyInstance{Name: "home", APIURL: srv.URL, LocalIP: "10.0.0.8"})
+	records, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"app.example.com", "nested.example.com", "www.example.com"}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %+v", len(want), records)
+	}
+	for i, name := range want {
+		if records[i].Name != name || records[i].IP != "10.0.0.8" {
+			t.Errorf("record %d = %+v, want %s -> 10.0.0.8", i, records[i], name)
+		}
+	}
+	if src.Name() != "caddy:home" {
+		t.Errorf("unexpected source name %q", src.Name())
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Change types reported by diffRecords.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// defaultChangeHistory is the number of changes kept by a new RecordStore.
+const defaultChangeHistory = 1000
+
+// Change describes a single record added, removed or changed by an update of
+// the record store.
+type Change struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	IP        string    `json:"ip,omitempty"` // comma-separated if the name has several addresses; target:port for SRV records
+	Source    string    `json:"source,omitempty"`
+	OldIP     string    `json:"old_ip,omitempty"`     // changed only
+	OldSource string    `json:"old_source,omitempty"` // changed only
+}
+
+// diffRecords compares two snapshots of the merged records and returns the
+// changes from old to new, sorted by name.
+func diffRecords(old, new map[string]Record, now time.Time) []Change {
+	var changes []Change
+	for name, r := range new {
+		prev, ok := old[name]
+		ip := r.rdata()
+		switch {
+		case !ok:
+			changes = append(changes, Change{Time: now, Type: ChangeAdded, Name: name, IP: ip, Source: r.Source})
+		case prev.rdata() != ip || prev.Source != r.Source:
+			changes = append(changes, Change{
+				Time: now, Type: ChangeChanged, Name: name, IP: ip, Source: r.Source,
+				OldIP: prev.rdata(), OldSource: prev.Source,
+			})
+		}
+	}
+	for name, r := range old {
+		if _, ok := new[name]; !ok {
+			changes = append(changes, Change{Time: now, Type: ChangeRemoved, Name: name, IP: r.rdata(), Source: r.Source})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// changeHistory is a bounded, append-only log of changes. Once full, the
+// oldest changes are dropped.
+type changeHistory struct {
+	limit   int
+	changes []Change
+}
+
+func (h *changeHistory) add(changes []Change) {
+	h.changes = append(h.changes, changes...)
+	if over := len(h.changes) - max(h.limit, 0); over > 0 {
+		h.changes = append([]Change(nil), h.changes[over:]...)
+	}
+}
+
+// since returns a copy of the changes recorded after t, oldest first.
+func (h *changeHistory) since(t time.Time) []Change {
+	i := sort.Search(len(h.changes), func(i int) bool { return h.changes[i].Time.After(t) })
+	return append([]Change(nil), h.changes[i:]...)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffRecords(t *testing.T) {
+	now := time.Now()
+	old := map[string]Record{
+		"keep.example.com.":   {Name: "keep.example.com.", IP: "10.0.0.1", Source: "pangolin"},
+		"gone.example.com.":   {Name: "gone.example.com.", IP: "10.0.0.1", Source: "pangolin"},
+		"moved.example.com.":  {Name: "moved.example.com.", IP: "10.0.0.1", Source: "pangolin"},
+		"source.example.com.": {Name: "source.example.com.", IP: "10.0.0.1", Source: "traefik"},
+	}
+	new := map[string]Record{
+		"keep.example.com.":   {Name: "keep.example.com.", IP: "10.0.0.1", Source: "pangolin"},
+		"moved.example.com.":  {Name: "moved.example.com.", IP: "10.0.0.2", Source: "pangolin"},
+		"source.example.com.": {Name: "source.example.com.", IP: "10.0.0.1", Source: "pangolin"},
+		"new.example.com.":    {Name: "new.example.com.", IP: "10.0.0.3", Source: "docker"},
+	}
+
+	changes := diffRecords(old, new, now)
+
+	want := []struct{ typ, name string }{
+		{ChangeRemoved, "gone.example.com."},
+		{ChangeChanged, "moved.example.com."},
+		{ChangeAdded, "new.example.com."},
+		{ChangeChanged, "source.example.com."},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].Type != w.typ || changes[i].Name != w.name {
+			t.Errorf("change %d = %s %s, want %s %s", i, changes[i].Type, changes[i].Name, w.typ, w.name)
+		}
+		if !changes[i].Time.Equal(now) {
+			t.Errorf("change %d has unexpected timestamp %v", i, changes[i].Time)
+		}
+	}
+	if changes[1].OldIP != "10.0.0.1" || changes[1].IP != "10.0.0.2" {
+		t.Errorf("expected IP change 10.0.0.1 -> 10.0.0.2, got %+v", changes[1])
+	}
+	if changes[3].OldSource != "traefik" || changes[3].Source != "pangolin" {
+		t.Errorf("expected source change traefik -> pangolin, got %+v", changes[3])
+	}
+}
+
+func TestDiffRecords_MultipleAddresses(t *testing.T) {
+	old := map[string]Record{
+		"nas.example.com.": {Name: "nas.example.com.", IP: "192.168.1.20", IPs: []string{"192.168.1.20", "192.168.1.21"}},
+	}
+	new := map[string]Record{
+		"nas.example.com.": {Name: "nas.example.com.", IP: "192.168.1.20"},
+	}
+
+	changes := diffRecords(old, new, time.Now())
+	if len(changes) != 1 || changes[0].Type != ChangeChanged {
+		t.Fatalf("expected a dropped address to be a change, got %+v", changes)
+	}
+	if changes[0].OldIP != "192.168.1.20,192.168.1.21" || changes[0].IP != "192.168.1.20" {
+		t.Errorf("unexpected addresses in %+v", changes[0])
+	}
+}
+
+func TestChangeHistory_IsBounded(t *testing.T) {
+	h := changeHistory{limit: 3}
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		h.add([]Change{{Time: base.Add(time.Duration(i) * time.Second), Name: string(rune('a' + i))}})
+	}
+
+	all := h.since(time.Time{})
+	if len(all) != 3 {
+		t.Fatalf("expected 3 changes kept, got %d", len(all))
+	}
+	if all[0].Name != "c" || all[2].Name != "e" {
+		t.Errorf("expected oldest changes to be dropped, got %+v", all)
+	}
+
+	recent := h.since(base.Add(3 * time.Second))
+	if len(recent) != 1 || recent[0].Name != "e" {
+		t.Errorf("expected only changes after t, got %+v", recent)
+	}
+}
+
+func TestChangeHistory_NegativeLimitKeepsNothing(t *testing.T) {
+	h := changeHistory{limit: -1}
+	h.add(nil)
+	h.add([]Change{{Time: time.Now(), Name: "a"}})
+	if n := len(h.since(time.Time{})); n != 0 {
+		t.Errorf("expected no changes kept, got %d", n)
+	}
+}
+
+func TestRecordStore_RecordsChanges(t *testing.T) {
+	s := NewRecordStore()
+	s.UpdateSource("pangolin", 0, 1, []Record{{Name: "a.example.com.", IP: "10.0.0.1", Source: "pangolin"}})
+	s.UpdateSource("pangolin", 0, 2, []Record{{Name: "b.example.com.", IP: "10.0.0.1", Source: "pangolin"}})
+	s.UpdateSource("pangolin", 0, 3, []Record{{Name: "b.example.com.", IP: "10.0.0.1", Source: "pangolin"}})
+
+	changes := s.Changes(time.Time{})
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes (add a, remove a, add b), got %+v", changes)
+	}
+	if changes[0].Type != ChangeAdded || changes[0].Name != "a.example.com." {
+		t.Errorf("unexpected first change %+v", changes[0])
+	}
+}
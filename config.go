@@ -3,52 +3,713 @@ package main
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	PangolinAPIURL    string
-	PangolinAPIKey    string
-	PangolinLocalIP   string
-	PangolinOrgID     string // optional: if empty, auto-discover via /v1/orgs
-	UpstreamDNS       string
-	PollInterval      time.Duration
+	Pangolin          []PangolinInstance
+	PangolinLocalIP   string        // default local IP for all sources
+	PollInterval      time.Duration // default poll interval for Pangolin instances
+	PollRetryInterval time.Duration // first re-poll delay after a failed poll, doubled up to the poll interval
+	APIRetry          RetryPolicy   // retries of individual Pangolin API requests
+	OrgConcurrency    int           // max orgs fetched in parallel per Pangolin instance
+	OrgTimeout        time.Duration // timeout for fetching all resources of one org
+	UpstreamDNS       string        // comma-separated upstream DNS servers, tried in order
+	ForwardRules      []ForwardRule // upstreams per domain suffix, overriding UpstreamDNS
 	DNSPort           string
 	HealthPort        string
 	EnableLocalPrefix bool
+	ChangeHistory     int // number of record changes kept for /changes
+
+	// Answers to HTTPS and SVCB queries for local names, which are never forwarded
+	HTTPSRecords string   // HTTPSNoData or HTTPSSynthesize
+	HTTPSALPN    []string // protocols advertised by synthesized records
+
+	// Blocking of listed domains (disabled unless blocklists are set)
+	Blocklists       []string      // URLs or file paths of hosts-format files or domain lists
+	BlocklistRefresh time.Duration // how often the blocklists are reloaded
+	Allowlist        []string      // domains never blocked, including the names below them
+	BlockResponse    string        // BlockNXDomain, BlockNull or BlockRefused
+	Blocking         bool          // whether clients outside all client groups are subject to blocking
+	ClientGroups     []ClientGroup // tried in order; the first containing the client applies
+
+	// Synthetic health probes of the upstream DNS servers (disabled when the interval is 0)
+	UpstreamProbeInterval time.Duration
+	UpstreamProbeTimeout  time.Duration
+	UpstreamProbeName     string // name whose NS records are queried
+
+	// Reachability probes of the local target IPs (disabled when TargetProbe is empty)
+	TargetProbe         string // TargetProbeTCP or TargetProbeHTTP
+	TargetProbePorts    []int  // tcp: ports tried in order
+	TargetProbeURL      string // http: URL template with an {ip} placeholder
+	TargetProbeInterval time.Duration
+	TargetProbeTimeout  time.Duration
+
+	// Traefik discovery source (disabled when TraefikAPIURL is empty)
+	TraefikAPIURL       string
+	TraefikLocalIP      string
+	TraefikPollInterval time.Duration
+	TraefikPriority     int
+
+	// Docker label discovery source (disabled when DockerSocket is empty)
+	DockerSocket       string
+	DockerLabel        string
+	DockerLocalIP      string
+	DockerPollInterval time.Duration
+	DockerPriority     int
+
+	// Caddy and Nginx Proxy Manager discovery sources, one per named instance
+	CaddyInstances []ProxyInstance
+	NPMInstances   []ProxyInstance
+
+	// Outgoing webhook notifications
+	Webhooks                []WebhookConfig
+	WebhookFailureThreshold int         // consecutive failed polls before a failure notification
+	WebhookRetry            RetryPolicy // retries of webhook deliveries
+
+	// Inbound push endpoint (disabled unless a token or secret is set)
+	PushToken    Secret        // bearer token accepted by /push
+	PushSecret   Secret        // HMAC-SHA256 key for signed /push requests
+	PushDebounce time.Duration // delay coalescing a burst of pushes into one refresh
+
+	// Admin API authentication (disabled unless credentials are set)
+	AdminAddr        string // separate listen address for the admin API; empty to serve it on HealthPort
+	AdminToken       Secret // bearer token granting the admin role
+	AdminUser        string // basic auth login granting the admin role
+	AdminPassword    Secret
+	ReadToken        Secret // bearer token granting the read role
+	ReadUser         string // basic auth login granting the read role
+	ReadPassword     Secret
+	HealthAnonymous  bool          // serve /healthz, /livez and /readyz without authentication
+	HealthMaxPollAge time.Duration // max age of a source's last successful poll; 0 for 3 poll intervals
+
+	// TLS for the admin and health server (disabled unless a certificate is set)
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string // CA bundle client certificates of admin API requests are verified against
+
+	secrets []Secret // all configured secrets, for reloading and log redaction
+}
+
+// PangolinInstance configures one Pangolin server to discover resources from.
+type PangolinInstance struct {
+	Name         string // empty for the single instance configured via PANGOLIN_API_URL etc.
+	APIURL       string
+	APIKey       Secret
+	OrgID        string // optional: if empty, auto-discover via /v1/orgs
+	LocalIP      string
+	PollInterval time.Duration
+	Priority     int // merge priority of Pangolin records over other sources
+
+	// Policies deciding which resources are served locally
+	RequireHealthy bool // skip resources whose targets are all unhealthy
+	RequireSSL     bool // skip resources without SSL
+
+	// Resources resolved directly to their backend targets instead of LocalIP
+	DirectNames []string // name patterns, e.g. "*.lan.example.com"
+	DirectOrgs  []string // org IDs
+
+	// Raw TCP/UDP resources, published as <name>.<SRVDomain> with SRV records
+	// (disabled when SRVDomain is empty)
+	SRVDomain   string
+	SRVServices map[string]string // resource name label → SRV service label
+}
+
+// ProxyInstance configures one instance of a reverse-proxy discovery source.
+type ProxyInstance struct {
+	Name         string
+	APIURL       string
+	LocalIP      string
+	PollInterval time.Duration
+	Priority     int
+	Identity     string // login for sources requiring authentication (NPM)
+	Secret       Secret
 }
 
 func LoadConfig() (*Config, error) {
 	cfg := &Config{
-		PangolinAPIURL:    envOrDefault("PANGOLIN_API_URL", "http://10.1.100.2:3004"),
-		PangolinAPIKey:    os.Getenv("PANGOLIN_API_KEY"),
 		PangolinLocalIP:   envOrDefault("PANGOLIN_LOCAL_IP", "10.1.100.2"),
-		PangolinOrgID:     os.Getenv("PANGOLIN_ORG_ID"),
 		UpstreamDNS:       envOrDefault("UPSTREAM_DNS", "1.1.1.1:53"),
 		DNSPort:           envOrDefault("DNS_PORT", "53"),
 		HealthPort:        envOrDefault("HEALTH_PORT", "8080"),
 		EnableLocalPrefix: envOrDefault("ENABLE_LOCAL_PREFIX", "true") == "true",
 	}
 
-	if cfg.PangolinAPIKey == "" {
-		return nil, fmt.Errorf("PANGOLIN_API_KEY is required")
-	}
-
 	if net.ParseIP(cfg.PangolinLocalIP) == nil {
 		return nil, fmt.Errorf("invalid PANGOLIN_LOCAL_IP: %q", cfg.PangolinLocalIP)
 	}
 
-	interval := envOrDefault("POLL_INTERVAL", "60s")
-	d, err := time.ParseDuration(interval)
-	if err != nil {
-		return nil, fmt.Errorf("invalid POLL_INTERVAL %q: %w", interval, err)
+	if len(splitUpstreams(cfg.UpstreamDNS)) == 0 {
+		return nil, fmt.Errorf("invalid UPSTREAM_DNS: %q", cfg.UpstreamDNS)
+	}
+
+	var err error
+	if cfg.PollInterval, err = envPositiveDuration("POLL_INTERVAL", "60s"); err != nil {
+		return nil, err
+	}
+	if cfg.UpstreamProbeInterval, err = envDuration("UPSTREAM_PROBE_INTERVAL", "30s"); err != nil {
+		return nil, err
+	}
+	if cfg.UpstreamProbeTimeout, err = envDuration("UPSTREAM_PROBE_TIMEOUT", "2s"); err != nil {
+		return nil, err
+	}
+	if cfg.UpstreamProbeInterval > 0 && cfg.UpstreamProbeTimeout <= 0 {
+		return nil, fmt.Errorf("invalid UPSTREAM_PROBE_TIMEOUT %s: must be positive", cfg.UpstreamProbeTimeout)
+	}
+	cfg.UpstreamProbeName = envOrDefault("UPSTREAM_PROBE_NAME", ".")
+
+	cfg.HTTPSRecords = envOrDefault("HTTPS_RECORDS", HTTPSNoData)
+	switch cfg.HTTPSRecords {
+	case HTTPSNoData, HTTPSSynthesize:
+	default:
+		return nil, fmt.Errorf("invalid HTTPS_RECORDS %q: must be %s or %s", cfg.HTTPSRecords, HTTPSNoData, HTTPSSynthesize)
+	}
+	cfg.HTTPSALPN = envList("HTTPS_ALPN", "h2,http/1.1")
+	if cfg.HTTPSRecords == HTTPSSynthesize && len(cfg.HTTPSALPN) == 0 {
+		return nil, fmt.Errorf("HTTPS_ALPN must not be empty when HTTPS_RECORDS=%s", HTTPSSynthesize)
+	}
+
+	cfg.Blocklists = envList("BLOCKLISTS", "")
+	if cfg.BlocklistRefresh, err = envDuration("BLOCKLIST_REFRESH", "24h"); err != nil {
+		return nil, err
+	}
+	if cfg.BlocklistRefresh <= 0 {
+		return nil, fmt.Errorf("invalid BLOCKLIST_REFRESH %s: must be positive", cfg.BlocklistRefresh)
+	}
+	cfg.Allowlist = envList("ALLOWLIST", "")
+	cfg.BlockResponse = envOrDefault("BLOCK_RESPONSE", BlockNXDomain)
+	switch cfg.BlockResponse {
+	case BlockNXDomain, BlockNull, BlockRefused:
+	default:
+		return nil, fmt.Errorf("invalid BLOCK_RESPONSE %q: must be nxdomain, null or refused", cfg.BlockResponse)
+	}
+	cfg.Blocking = envOrDefault("BLOCKING", "true") == "true"
+	if cfg.ClientGroups, err = loadClientGroups(); err != nil {
+		return nil, err
+	}
+
+	cfg.TargetProbe = os.Getenv("TARGET_PROBE")
+	switch cfg.TargetProbe {
+	case "", TargetProbeTCP, TargetProbeHTTP:
+	default:
+		return nil, fmt.Errorf("invalid TARGET_PROBE %q: must be tcp or http", cfg.TargetProbe)
+	}
+	for _, p := range strings.Split(envOrDefault("TARGET_PROBE_PORTS", "443,80"), ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid TARGET_PROBE_PORTS port %q", p)
+		}
+		cfg.TargetProbePorts = append(cfg.TargetProbePorts, port)
+	}
+	cfg.TargetProbeURL = envOrDefault("TARGET_PROBE_URL", "http://{ip}/")
+	if cfg.TargetProbeInterval, err = envDuration("TARGET_PROBE_INTERVAL", "15s"); err != nil {
+		return nil, err
+	}
+	if cfg.TargetProbeTimeout, err = envDuration("TARGET_PROBE_TIMEOUT", "2s"); err != nil {
+		return nil, err
+	}
+	if cfg.TargetProbe != "" && cfg.TargetProbeInterval <= 0 {
+		return nil, fmt.Errorf("invalid TARGET_PROBE_INTERVAL %s: must be positive", cfg.TargetProbeInterval)
+	}
+	if cfg.TargetProbe != "" && cfg.TargetProbeTimeout <= 0 {
+		return nil, fmt.Errorf("invalid TARGET_PROBE_TIMEOUT %s: must be positive", cfg.TargetProbeTimeout)
+	}
+	if cfg.ChangeHistory, err = envInt("CHANGE_HISTORY", "1000"); err != nil {
+		return nil, err
+	}
+	if cfg.ChangeHistory < 0 {
+		return nil, fmt.Errorf("invalid CHANGE_HISTORY %d: must not be negative", cfg.ChangeHistory)
+	}
+	if cfg.PollRetryInterval, err = envDuration("POLL_RETRY_INTERVAL", "5s"); err != nil {
+		return nil, err
+	}
+	if cfg.APIRetry.Attempts, err = envInt("API_RETRIES", "3"); err != nil {
+		return nil, err
+	}
+	if cfg.APIRetry.BaseDelay, err = envDuration("API_RETRY_DELAY", "500ms"); err != nil {
+		return nil, err
+	}
+	cfg.APIRetry.MaxDelay = 10 * time.Second
+	if cfg.OrgConcurrency, err = envInt("ORG_CONCURRENCY", "4"); err != nil {
+		return nil, err
+	}
+	if cfg.OrgConcurrency < 1 {
+		return nil, fmt.Errorf("invalid ORG_CONCURRENCY %d: must be at least 1", cfg.OrgConcurrency)
+	}
+	if cfg.OrgTimeout, err = envDuration("ORG_TIMEOUT", "30s"); err != nil {
+		return nil, err
+	}
+
+	if cfg.Pangolin, err = loadPangolinInstances(cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.TraefikAPIURL = os.Getenv("TRAEFIK_API_URL")
+	if cfg.TraefikAPIURL != "" {
+		cfg.TraefikLocalIP = envOrDefault("TRAEFIK_LOCAL_IP", cfg.PangolinLocalIP)
+		if net.ParseIP(cfg.TraefikLocalIP) == nil {
+			return nil, fmt.Errorf("invalid TRAEFIK_LOCAL_IP: %q", cfg.TraefikLocalIP)
+		}
+		if cfg.TraefikPollInterval, err = envPositiveDuration("TRAEFIK_POLL_INTERVAL", "60s"); err != nil {
+			return nil, err
+		}
+		if cfg.TraefikPriority, err = envInt("TRAEFIK_PRIORITY", "50"); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.DockerSocket = os.Getenv("DOCKER_SOCKET")
+	if cfg.DockerSocket != "" {
+		cfg.DockerLabel = envOrDefault("DOCKER_LABEL", "pangolin-dns.host")
+		cfg.DockerLocalIP = envOrDefault("DOCKER_LOCAL_IP", cfg.PangolinLocalIP)
+		if net.ParseIP(cfg.DockerLocalIP) == nil {
+			return nil, fmt.Errorf("invalid DOCKER_LOCAL_IP: %q", cfg.DockerLocalIP)
+		}
+		if cfg.DockerPollInterval, err = envPositiveDuration("DOCKER_POLL_INTERVAL", "60s"); err != nil {
+			return nil, err
+		}
+		if cfg.DockerPriority, err = envInt("DOCKER_PRIORITY", "50"); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.CaddyInstances, err = loadProxyInstances(cfg, "CADDY"); err != nil {
+		return nil, err
+	}
+	if cfg.NPMInstances, err = loadProxyInstances(cfg, "NPM"); err != nil {
+		return nil, err
+	}
+	for _, inst := range cfg.NPMInstances {
+		if inst.Identity == "" || !inst.Secret.IsSet() {
+			return nil, fmt.Errorf("NPM instance %q requires an identity and secret", inst.Name)
+		}
+	}
+
+	if cfg.ForwardRules, err = loadForwardRules(); err != nil {
+		return nil, err
+	}
+	if cfg.Webhooks, err = loadWebhooks(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookFailureThreshold, err = envInt("WEBHOOK_FAILURE_THRESHOLD", "3"); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookRetry.Attempts, err = envInt("WEBHOOK_RETRIES", "3"); err != nil {
+		return nil, err
+	}
+	cfg.WebhookRetry.BaseDelay = time.Second
+	cfg.WebhookRetry.MaxDelay = 30 * time.Second
+
+	if cfg.PushToken, err = cfg.envSecret("PUSH_TOKEN"); err != nil {
+		return nil, err
+	}
+	if cfg.PushSecret, err = cfg.envSecret("PUSH_SECRET"); err != nil {
+		return nil, err
+	}
+	if cfg.PushDebounce, err = envDuration("PUSH_DEBOUNCE", "2s"); err != nil {
+		return nil, err
+	}
+
+	cfg.AdminAddr = os.Getenv("ADMIN_ADDR")
+	cfg.AdminUser = os.Getenv("ADMIN_USER")
+	cfg.ReadUser = os.Getenv("READ_USER")
+	cfg.HealthAnonymous = envOrDefault("HEALTH_ANONYMOUS", "true") == "true"
+	if cfg.HealthMaxPollAge, err = envDuration("HEALTH_MAX_POLL_AGE", "0s"); err != nil {
+		return nil, err
+	}
+	if cfg.AdminToken, err = cfg.envSecret("ADMIN_TOKEN"); err != nil {
+		return nil, err
+	}
+	if cfg.AdminPassword, err = cfg.envSecret("ADMIN_PASSWORD"); err != nil {
+		return nil, err
+	}
+	if cfg.ReadToken, err = cfg.envSecret("READ_TOKEN"); err != nil {
+		return nil, err
+	}
+	if cfg.ReadPassword, err = cfg.envSecret("READ_PASSWORD"); err != nil {
+		return nil, err
+	}
+	if (cfg.AdminUser == "") != !cfg.AdminPassword.IsSet() {
+		return nil, fmt.Errorf("ADMIN_USER and ADMIN_PASSWORD must be set together")
+	}
+	if (cfg.ReadUser == "") != !cfg.ReadPassword.IsSet() {
+		return nil, fmt.Errorf("READ_USER and READ_PASSWORD must be set together")
+	}
+
+	cfg.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	cfg.TLSClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
 	}
-	cfg.PollInterval = d
 
 	return cfg, nil
 }
 
+// loadForwardRules reads the forwarding rules listed in FORWARD_RULES
+// (comma-separated), each configured via FORWARD_<NAME>_DOMAINS,
+// _UPSTREAMS and _PROTOCOL. Upstreams without a port use 53, or 853 for TLS.
+func loadForwardRules() ([]ForwardRule, error) {
+	var rules []ForwardRule
+	for _, name := range strings.Split(os.Getenv("FORWARD_RULES"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		key := "FORWARD_" + envName(name) + "_"
+
+		rule := ForwardRule{
+			Name:     name,
+			Protocol: os.Getenv(key + "PROTOCOL"),
+		}
+		port := "53"
+		switch rule.Protocol {
+		case "", ForwardUDP, ForwardTCP:
+		case ForwardTLS:
+			port = "853"
+		default:
+			return nil, fmt.Errorf("invalid %sPROTOCOL %q: must be udp, tcp or tls", key, rule.Protocol)
+		}
+		for _, domain := range envList(key+"DOMAINS", "") {
+			rule.Domains = append(rule.Domains, normalizeForwardDomain(domain))
+		}
+		for _, upstream := range envList(key+"UPSTREAMS", "") {
+			if _, _, err := net.SplitHostPort(upstream); err != nil {
+				upstream = net.JoinHostPort(upstream, port)
+			}
+			rule.Upstreams = append(rule.Upstreams, upstream)
+		}
+		if len(rule.Domains) == 0 {
+			return nil, fmt.Errorf("%sDOMAINS is required", key)
+		}
+		if len(rule.Upstreams) == 0 {
+			return nil, fmt.Errorf("%sUPSTREAMS is required", key)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// loadClientGroups reads the client groups listed in CLIENT_GROUPS
+// (comma-separated), each configured via CLIENT_GROUP_<NAME>_NETWORKS
+// (addresses or CIDR prefixes) and _BLOCKING.
+func loadClientGroups() ([]ClientGroup, error) {
+	var groups []ClientGroup
+	for _, name := range strings.Split(os.Getenv("CLIENT_GROUPS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		key := "CLIENT_GROUP_" + envName(name) + "_"
+
+		group := ClientGroup{
+			Name:     name,
+			Blocking: envOrDefault(key+"BLOCKING", "true") == "true",
+		}
+		for _, n := range envList(key+"NETWORKS", "") {
+			prefix, err := netip.ParsePrefix(n)
+			if err != nil {
+				addr, aerr := netip.ParseAddr(n)
+				if aerr != nil {
+					return nil, fmt.Errorf("invalid %sNETWORKS entry %q: %w", key, n, err)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			group.Networks = append(group.Networks, prefix.Masked())
+		}
+		if len(group.Networks) == 0 {
+			return nil, fmt.Errorf("%sNETWORKS is required", key)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// loadWebhooks reads the webhooks listed in WEBHOOKS (comma-separated), each
+// configured via WEBHOOK_<NAME>_URL, _FORMAT and _SECRET.
+func loadWebhooks(cfg *Config) ([]WebhookConfig, error) {
+	var hooks []WebhookConfig
+	for _, name := range strings.Split(os.Getenv("WEBHOOKS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		key := "WEBHOOK_" + envName(name) + "_"
+
+		hook := WebhookConfig{
+			Name:   name,
+			Format: envOrDefault(key+"FORMAT", WebhookJSON),
+		}
+		var err error
+		if hook.URL, err = cfg.envSecret(key + "URL"); err != nil {
+			return nil, err
+		}
+		if hook.Secret, err = cfg.envSecret(key + "SECRET"); err != nil {
+			return nil, err
+		}
+		if !hook.URL.IsSet() {
+			return nil, fmt.Errorf("%sURL is required", key)
+		}
+		switch hook.Format {
+		case WebhookJSON, WebhookSlack, WebhookDiscord, WebhookNtfy:
+		default:
+			return nil, fmt.Errorf("invalid %sFORMAT %q: must be json, slack, discord or ntfy", key, hook.Format)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// loadPangolinInstances reads the Pangolin instances listed in
+// PANGOLIN_INSTANCES (comma-separated), each configured via
+// PANGOLIN_<NAME>_API_URL, _API_KEY, _ORG_ID, _LOCAL_IP, _POLL_INTERVAL,
+// _PRIORITY, _REQUIRE_HEALTHY, _REQUIRE_SSL, _DIRECT_NAMES, _DIRECT_ORGS,
+// _SRV_DOMAIN and _SRV_SERVICES; all but the first six default to the
+// corresponding PANGOLIN_* variables. Without
+// PANGOLIN_INSTANCES, a single unnamed instance is configured from
+// PANGOLIN_API_URL, PANGOLIN_API_KEY, PANGOLIN_ORG_ID, PANGOLIN_PRIORITY and
+// the policy and direct mode variables.
+func loadPangolinInstances(cfg *Config) ([]PangolinInstance, error) {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("PANGOLIN_INSTANCES"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	if err := checkInstanceNames("PANGOLIN_INSTANCES", names); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	var instances []PangolinInstance
+	for _, name := range names {
+		key := "PANGOLIN_"
+		apiURLDefault := ""
+		if name == "" {
+			apiURLDefault = "http://10.1.100.2:3004"
+		} else {
+			key += envName(name) + "_"
+		}
+
+		inst := PangolinInstance{
+			Name:         name,
+			APIURL:       envOrDefault(key+"API_URL", apiURLDefault),
+			OrgID:        os.Getenv(key + "ORG_ID"),
+			LocalIP:      envOrDefault(key+"LOCAL_IP", cfg.PangolinLocalIP),
+			PollInterval: cfg.PollInterval,
+
+			RequireHealthy: envOrDefault(key+"REQUIRE_HEALTHY", envOrDefault("PANGOLIN_REQUIRE_HEALTHY", "false")) == "true",
+			RequireSSL:     envOrDefault(key+"REQUIRE_SSL", envOrDefault("PANGOLIN_REQUIRE_SSL", "false")) == "true",
+
+			DirectNames: envList(key+"DIRECT_NAMES", os.Getenv("PANGOLIN_DIRECT_NAMES")),
+			DirectOrgs:  envList(key+"DIRECT_ORGS", os.Getenv("PANGOLIN_DIRECT_ORGS")),
+
+			SRVDomain: strings.Trim(strings.ToLower(envOrDefault(key+"SRV_DOMAIN", os.Getenv("PANGOLIN_SRV_DOMAIN"))), "."),
+		}
+		if inst.APIURL == "" {
+			return nil, fmt.Errorf("%sAPI_URL is required", key)
+		}
+		var err error
+		if inst.APIKey, err = cfg.envSecret(key + "API_KEY"); err != nil {
+			return nil, err
+		}
+		if !inst.APIKey.IsSet() {
+			return nil, fmt.Errorf("%sAPI_KEY is required", key)
+		}
+		if net.ParseIP(inst.LocalIP) == nil {
+			return nil, fmt.Errorf("invalid %sLOCAL_IP: %q", key, inst.LocalIP)
+		}
+		for i, pattern := range inst.DirectNames {
+			inst.DirectNames[i] = strings.TrimSuffix(strings.ToLower(pattern), ".")
+			if _, err := path.Match(inst.DirectNames[i], ""); err != nil {
+				return nil, fmt.Errorf("invalid %sDIRECT_NAMES pattern %q: %w", key, pattern, err)
+			}
+		}
+		for _, item := range envList(key+"SRV_SERVICES", os.Getenv("PANGOLIN_SRV_SERVICES")) {
+			resource, service, ok := strings.Cut(item, "=")
+			if !ok || dnsLabel(resource) == "" || dnsLabel(service) == "" {
+				return nil, fmt.Errorf("invalid %sSRV_SERVICES entry %q: must be resource=service", key, item)
+			}
+			if inst.SRVServices == nil {
+				inst.SRVServices = make(map[string]string)
+			}
+			inst.SRVServices[dnsLabel(resource)] = dnsLabel(service)
+		}
+
+		if name != "" {
+			if inst.PollInterval, err = envPositiveDuration(key+"POLL_INTERVAL", cfg.PollInterval.String()); err != nil {
+				return nil, err
+			}
+		}
+		if inst.Priority, err = envInt(key+"PRIORITY", "100"); err != nil {
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// loadProxyInstances reads the named instances listed in <PREFIX>_INSTANCES
+// (comma-separated). Each instance NAME is configured via
+// <PREFIX>_<NAME>_API_URL, _LOCAL_IP, _POLL_INTERVAL, _PRIORITY, _IDENTITY
+// and _SECRET.
+func loadProxyInstances(cfg *Config, prefix string) ([]ProxyInstance, error) {
+	var names []string
+	for _, name := range strings.Split(os.Getenv(prefix+"_INSTANCES"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	if err := checkInstanceNames(prefix+"_INSTANCES", names); err != nil {
+		return nil, err
+	}
+
+	var instances []ProxyInstance
+	for _, name := range names {
+		key := prefix + "_" + envName(name) + "_"
+
+		inst := ProxyInstance{
+			Name:     name,
+			APIURL:   os.Getenv(key + "API_URL"),
+			LocalIP:  envOrDefault(key+"LOCAL_IP", cfg.PangolinLocalIP),
+			Identity: os.Getenv(key + "IDENTITY"),
+		}
+		var err error
+		if inst.Secret, err = cfg.envSecret(key + "SECRET"); err != nil {
+			return nil, err
+		}
+		if inst.APIURL == "" {
+			return nil, fmt.Errorf("%sAPI_URL is required", key)
+		}
+		if net.ParseIP(inst.LocalIP) == nil {
+			return nil, fmt.Errorf("invalid %sLOCAL_IP: %q", key, inst.LocalIP)
+		}
+
+		if inst.PollInterval, err = envPositiveDuration(key+"POLL_INTERVAL", "60s"); err != nil {
+			return nil, err
+		}
+		if inst.Priority, err = envInt(key+"PRIORITY", "50"); err != nil {
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// checkInstanceNames rejects instance names listed twice in key, including
+// names such as "home-lab" and "home_lab" that are configured by the same
+// variables. Each instance publishes its records under its own source name.
+func checkInstanceNames(key string, names []string) error {
+	seen := make(map[string]string) // envName → name
+	for _, name := range names {
+		if prev, ok := seen[envName(name)]; ok {
+			if prev == name {
+				return fmt.Errorf("invalid %s: %q is listed twice", key, name)
+			}
+			return fmt.Errorf("invalid %s: %q and %q are configured by the same variables", key, prev, name)
+		}
+		seen[envName(name)] = name
+	}
+	return nil
+}
+
+// envSecret reads a secret via envSecret and registers it with the config
+// for reloading and log redaction.
+func (cfg *Config) envSecret(key string) (Secret, error) {
+	s, err := envSecret(key)
+	if err != nil {
+		return Secret{}, err
+	}
+	cfg.secrets = append(cfg.secrets, s)
+	return s, nil
+}
+
+// Secrets returns all configured secrets.
+func (cfg *Config) Secrets() []Secret {
+	return cfg.secrets
+}
+
+// ReloadSecrets re-reads all file-based secrets. Secrets whose file cannot
+// be read keep their previous value; the first error is returned.
+func (cfg *Config) ReloadSecrets() error {
+	var first error
+	for _, s := range cfg.secrets {
+		if err := s.Reload(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// envName converts an instance name into its environment variable form,
+// e.g. "home-lab" → "HOME_LAB".
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func envDuration(key, fallback string) (time.Duration, error) {
+	v := envOrDefault(key, fallback)
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return d, nil
+}
+
+// envPositiveDuration reads a duration that must be positive, such as a poll
+// interval.
+func envPositiveDuration(key, fallback string) (time.Duration, error) {
+	d, err := envDuration(key, fallback)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("invalid %s %s: must be positive", key, d)
+	}
+	return d, err
+}
+
+func envInt(key, fallback string) (int, error) {
+	v := envOrDefault(key, fallback)
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return n, nil
+}
+
+// envList returns the comma-separated, non-empty items of key, or of
+// fallback if key is unset.
+func envList(key, fallback string) []string {
+	var items []string
+	for _, item := range strings.Split(envOrDefault(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func envOrDefault(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
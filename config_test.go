@@ -21,6 +21,16 @@ func TestLoadConfig_InvalidPollInterval(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_NonPositivePollInterval(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	for _, v := range []string{"0s", "-1m"} {
+		t.Setenv("POLL_INTERVAL", v)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("expected error for POLL_INTERVAL=%s", v)
+		}
+	}
+}
+
 func TestLoadConfig_InvalidLocalIP(t *testing.T) {
 	t.Setenv("PANGOLIN_API_KEY", "test.key")
 	t.Setenv("PANGOLIN_LOCAL_IP", "not-an-ip")
@@ -30,6 +40,15 @@ func TestLoadConfig_InvalidLocalIP(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_NegativeChangeHistory(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("CHANGE_HISTORY", "-1")
+	_, err := LoadConfig()
+	if err == nil {
+		t.Error("expected error for negative CHANGE_HISTORY")
+	}
+}
+
 func TestLoadConfig_Defaults(t *testing.T) {
 	t.Setenv("PANGOLIN_API_KEY", "test.key")
 	t.Setenv("PANGOLIN_LOCAL_IP", "")   // force default
@@ -87,3 +106,507 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 		t.Errorf("expected health port 9090, got %q", cfg.HealthPort)
 	}
 }
+
+func TestLoadConfig_Traefik(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("PANGOLIN_LOCAL_IP", "10.0.0.1")
+	t.Setenv("TRAEFIK_API_URL", "http://traefik:8080")
+	t.Setenv("TRAEFIK_LOCAL_IP", "")
+	t.Setenv("TRAEFIK_POLL_INTERVAL", "15s")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TraefikLocalIP != "10.0.0.1" {
+		t.Errorf("expected Traefik local IP to default to PANGOLIN_LOCAL_IP, got %q", cfg.TraefikLocalIP)
+	}
+	if cfg.TraefikPollInterval.Seconds() != 15 {
+		t.Errorf("expected 15s, got %s", cfg.TraefikPollInterval)
+	}
+	if cfg.TraefikPriority != 50 {
+		t.Errorf("expected default Traefik priority 50, got %d", cfg.TraefikPriority)
+	}
+}
+
+func TestLoadConfig_TraefikNonPositivePollInterval(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("TRAEFIK_API_URL", "http://traefik:8080")
+	t.Setenv("TRAEFIK_POLL_INTERVAL", "0s")
+	_, err := LoadConfig()
+	if err == nil {
+		t.Error("expected error for TRAEFIK_POLL_INTERVAL=0s")
+	}
+}
+
+func TestLoadConfig_DockerNonPositivePollInterval(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("DOCKER_SOCKET", "/var/run/docker.sock")
+	t.Setenv("DOCKER_POLL_INTERVAL", "0s")
+	_, err := LoadConfig()
+	if err == nil {
+		t.Error("expected error for DOCKER_POLL_INTERVAL=0s")
+	}
+}
+
+func TestLoadConfig_ProxyInstances(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("PANGOLIN_LOCAL_IP", "10.0.0.1")
+	t.Setenv("CADDY_INSTANCES", "home, home-lab")
+	t.Setenv("CADDY_HOME_API_URL", "http://caddy:2019")
+	t.Setenv("CADDY_HOME_LAB_API_URL", "http://caddy-lab:2019")
+	t.Setenv("CADDY_HOME_LAB_LOCAL_IP", "10.0.0.2")
+	t.Setenv("CADDY_HOME_LAB_PRIORITY", "70")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.CaddyInstances) != 2 {
+		t.Fatalf("expected 2 Caddy instances, got %d", len(cfg.CaddyInstances))
+	}
+	home, lab := cfg.CaddyInstances[0], cfg.CaddyInstances[1]
+	if home.Name != "home" || home.LocalIP != "10.0.0.1" || home.Priority != 50 {
+		t.Errorf("unexpected home instance %+v", home)
+	}
+	if lab.Name != "home-lab" || lab.APIURL != "http://caddy-lab:2019" || lab.LocalIP != "10.0.0.2" || lab.Priority != 70 {
+		t.Errorf("unexpected home-lab instance %+v", lab)
+	}
+}
+
+func TestLoadConfig_ProxyInstanceNonPositivePollInterval(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	for _, prefix := range []string{"CADDY", "NPM"} {
+		t.Run(prefix, func(t *testing.T) {
+			t.Setenv(prefix+"_INSTANCES", "home")
+			t.Setenv(prefix+"_HOME_API_URL", "http://proxy:2019")
+			t.Setenv(prefix+"_HOME_IDENTITY", "admin@example.com")
+			t.Setenv(prefix+"_HOME_SECRET", "changeme")
+			t.Setenv(prefix+"_HOME_POLL_INTERVAL", "0s")
+			_, err := LoadConfig()
+			if err == nil {
+				t.Errorf("expected error for %s_HOME_POLL_INTERVAL=0s", prefix)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_NPMRequiresCredentials(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("NPM_INSTANCES", "office")
+	t.Setenv("NPM_OFFICE_API_URL", "http://npm:81")
+	_, err := LoadConfig()
+	if err == nil {
+		t.Error("expected error for NPM instance without identity/secret")
+	}
+}
+
+func TestLoadConfig_SinglePangolinInstance(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("PANGOLIN_INSTANCES", "")
+	t.Setenv("PANGOLIN_ORG_ID", "org1")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Pangolin) != 1 {
+		t.Fatalf("expected 1 Pangolin instance, got %d", len(cfg.Pangolin))
+	}
+	inst := cfg.Pangolin[0]
+	if inst.Name != "" || inst.APIKey.Value() != "test.key" || inst.OrgID != "org1" || inst.Priority != 100 {
+		t.Errorf("unexpected instance %+v", inst)
+	}
+	if inst.APIURL != "http://10.1.100.2:3004" {
+		t.Errorf("expected default API URL, got %q", inst.APIURL)
+	}
+}
+
+func TestLoadConfig_MultiplePangolinInstances(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "")
+	t.Setenv("PANGOLIN_LOCAL_IP", "10.0.0.1")
+	t.Setenv("POLL_INTERVAL", "45s")
+	t.Setenv("PANGOLIN_INSTANCES", "home,office")
+	t.Setenv("PANGOLIN_HOME_API_URL", "http://home:3004")
+	t.Setenv("PANGOLIN_HOME_API_KEY", "home.key")
+	t.Setenv("PANGOLIN_OFFICE_API_URL", "http://office:3004")
+	t.Setenv("PANGOLIN_OFFICE_API_KEY", "office.key")
+	t.Setenv("PANGOLIN_OFFICE_ORG_ID", "acme")
+	t.Setenv("PANGOLIN_OFFICE_LOCAL_IP", "10.2.0.1")
+	t.Setenv("PANGOLIN_OFFICE_POLL_INTERVAL", "2m")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Pangolin) != 2 {
+		t.Fatalf("expected 2 Pangolin instances, got %d", len(cfg.Pangolin))
+	}
+	home, office := cfg.Pangolin[0], cfg.Pangolin[1]
+	if home.Name != "home" || home.APIKey.Value() != "home.key" || home.LocalIP != "10.0.0.1" || home.PollInterval.Seconds() != 45 {
+		t.Errorf("unexpected home instance %+v", home)
+	}
+	if office.OrgID != "acme" || office.LocalIP != "10.2.0.1" || office.PollInterval.Minutes() != 2 {
+		t.Errorf("unexpected office instance %+v", office)
+	}
+}
+
+func TestLoadConfig_PangolinInstanceNonPositivePollInterval(t *testing.T) {
+	t.Setenv("PANGOLIN_INSTANCES", "home")
+	t.Setenv("PANGOLIN_HOME_API_URL", "http://home:3004")
+	t.Setenv("PANGOLIN_HOME_API_KEY", "home.key")
+	t.Setenv("PANGOLIN_HOME_POLL_INTERVAL", "0s")
+	_, err := LoadConfig()
+	if err == nil {
+		t.Error("expected error for PANGOLIN_HOME_POLL_INTERVAL=0s")
+	}
+}
+
+func TestLoadConfig_PangolinInstancesSkipEmptyNames(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "")
+	t.Setenv("PANGOLIN_INSTANCES", "home, ,")
+	t.Setenv("PANGOLIN_HOME_API_URL", "http://home:3004")
+	t.Setenv("PANGOLIN_HOME_API_KEY", "home.key")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Pangolin) != 1 || cfg.Pangolin[0].Name != "home" {
+		t.Errorf("expected only the home instance, got %+v", cfg.Pangolin)
+	}
+
+	// Only empty names fall back to the single unnamed instance.
+	t.Setenv("PANGOLIN_INSTANCES", " , ")
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	if cfg, err = LoadConfig(); err != nil || len(cfg.Pangolin) != 1 || cfg.Pangolin[0].Name != "" {
+		t.Errorf("expected the unnamed instance, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestLoadConfig_DuplicateInstanceNames(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("PANGOLIN_HOME_API_URL", "http://home:3004")
+	t.Setenv("PANGOLIN_HOME_API_KEY", "home.key")
+	t.Setenv("PANGOLIN_HOME_LAB_API_URL", "http://lab:3004")
+	t.Setenv("PANGOLIN_HOME_LAB_API_KEY", "lab.key")
+	t.Setenv("CADDY_HOME_API_URL", "http://caddy:2019")
+	t.Setenv("CADDY_HOME_LAB_API_URL", "http://caddy-lab:2019")
+	t.Setenv("NPM_HOME_API_URL", "http://npm:81")
+	t.Setenv("NPM_HOME_IDENTITY", "admin@example.com")
+	t.Setenv("NPM_HOME_SECRET", "changeme")
+
+	for _, tc := range []struct{ key, value string }{
+		{"PANGOLIN_INSTANCES", "home,home"},
+		{"PANGOLIN_INSTANCES", "home-lab,home_lab"},
+		{"PANGOLIN_INSTANCES", "home,HOME"},
+		{"CADDY_INSTANCES", "home, home"},
+		{"CADDY_INSTANCES", "home-lab,home_lab"},
+		{"NPM_INSTANCES", "home,home"},
+	} {
+		t.Run(tc.key+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.key, tc.value)
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("expected error for %s=%q", tc.key, tc.value)
+			}
+		})
+	}
+
+	t.Setenv("PANGOLIN_INSTANCES", "home,home-lab")
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("unexpected error for distinct names: %v", err)
+	}
+}
+
+func TestLoadConfig_PangolinInstanceMissingKey(t *testing.T) {
+	t.Setenv("PANGOLIN_INSTANCES", "home")
+	t.Setenv("PANGOLIN_HOME_API_URL", "http://home:3004")
+	t.Setenv("PANGOLIN_HOME_API_KEY", "")
+	_, err := LoadConfig()
+	if err == nil {
+		t.Error("expected error for Pangolin instance without API key")
+	}
+}
+
+func TestLoadConfig_Webhooks(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("WEBHOOKS", "ops, chat-room")
+	t.Setenv("WEBHOOK_OPS_URL", "http://hooks.example/ops")
+	t.Setenv("WEBHOOK_OPS_SECRET", "s3cret")
+	t.Setenv("WEBHOOK_CHAT_ROOM_URL", "http://chat.example/hook")
+	t.Setenv("WEBHOOK_CHAT_ROOM_FORMAT", "slack")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Webhooks) != 2 {
+		t.Fatalf("expected 2 webhooks, got %d", len(cfg.Webhooks))
+	}
+	ops, chat := cfg.Webhooks[0], cfg.Webhooks[1]
+	if ops.Name != "ops" || ops.Format != WebhookJSON || ops.Secret.Value() != "s3cret" {
+		t.Errorf("unexpected ops webhook %+v", ops)
+	}
+	if chat.Name != "chat-room" || chat.URL.Value() != "http://chat.example/hook" || chat.Format != WebhookSlack {
+		t.Errorf("unexpected chat-room webhook %+v", chat)
+	}
+	if cfg.WebhookFailureThreshold != 3 {
+		t.Errorf("expected default failure threshold 3, got %d", cfg.WebhookFailureThreshold)
+	}
+}
+
+func TestLoadConfig_WebhookInvalidFormat(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("WEBHOOKS", "ops")
+	t.Setenv("WEBHOOK_OPS_URL", "http://hooks.example/ops")
+	t.Setenv("WEBHOOK_OPS_FORMAT", "teams")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for unknown webhook format")
+	}
+}
+
+func TestLoadConfig_AdminAuth(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("ADMIN_ADDR", "127.0.0.1:8081")
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	t.Setenv("READ_USER", "viewer")
+	t.Setenv("READ_PASSWORD", "viewer-pass")
+	t.Setenv("HEALTH_ANONYMOUS", "false")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AdminAddr != "127.0.0.1:8081" || cfg.AdminToken.Value() != "admin-token" || cfg.ReadUser != "viewer" || cfg.HealthAnonymous {
+		t.Errorf("unexpected admin auth config %+v", cfg)
+	}
+
+	t.Setenv("READ_PASSWORD", "")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for READ_USER without READ_PASSWORD")
+	}
+}
+
+func TestLoadConfig_TLSRequiresCertAndKey(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("TLS_CERT_FILE", "/certs/tls.crt")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for TLS_CERT_FILE without TLS_KEY_FILE")
+	}
+
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_CLIENT_CA_FILE", "/certs/ca.crt")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for TLS_CLIENT_CA_FILE without a server certificate")
+	}
+}
+
+func TestLoadConfig_UpstreamProbeTimeout(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("UPSTREAM_PROBE_TIMEOUT", "0s")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for UPSTREAM_PROBE_TIMEOUT=0s while probing")
+	}
+
+	t.Setenv("UPSTREAM_PROBE_INTERVAL", "0s") // probing disabled
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("unexpected error with probing disabled: %v", err)
+	}
+}
+
+func TestLoadConfig_TargetProbe(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("TARGET_PROBE", "tcp")
+	t.Setenv("TARGET_PROBE_PORTS", "8443, 80")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TargetProbe != TargetProbeTCP || len(cfg.TargetProbePorts) != 2 || cfg.TargetProbePorts[0] != 8443 {
+		t.Errorf("unexpected target probe config: %q %v", cfg.TargetProbe, cfg.TargetProbePorts)
+	}
+
+	t.Setenv("TARGET_PROBE_PORTS", "70000")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for an invalid TARGET_PROBE_PORTS port")
+	}
+	t.Setenv("TARGET_PROBE_PORTS", "")
+
+	for _, key := range []string{"TARGET_PROBE_INTERVAL", "TARGET_PROBE_TIMEOUT"} {
+		t.Setenv(key, "0s")
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("expected error for %s=0s", key)
+		}
+		t.Setenv(key, "")
+	}
+
+	t.Setenv("TARGET_PROBE_PORTS", "")
+	t.Setenv("TARGET_PROBE", "icmp")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for an unknown TARGET_PROBE mode")
+	}
+}
+
+func TestLoadConfig_PangolinPolicies(t *testing.T) {
+	t.Setenv("PANGOLIN_INSTANCES", "home,office")
+	t.Setenv("PANGOLIN_REQUIRE_SSL", "true")
+	t.Setenv("PANGOLIN_HOME_API_URL", "http://home:3004")
+	t.Setenv("PANGOLIN_HOME_API_KEY", "home.key")
+	t.Setenv("PANGOLIN_HOME_REQUIRE_HEALTHY", "true")
+	t.Setenv("PANGOLIN_OFFICE_API_URL", "http://office:3004")
+	t.Setenv("PANGOLIN_OFFICE_API_KEY", "office.key")
+	t.Setenv("PANGOLIN_OFFICE_REQUIRE_SSL", "false")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	home, office := cfg.Pangolin[0], cfg.Pangolin[1]
+	if !home.RequireHealthy || !home.RequireSSL {
+		t.Errorf("expected home to require healthy targets and SSL, got %+v", home)
+	}
+	if office.RequireHealthy || office.RequireSSL {
+		t.Errorf("expected office to override the SSL policy, got %+v", office)
+	}
+}
+
+func TestLoadConfig_PangolinDirectMode(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("PANGOLIN_DIRECT_NAMES", "*.LAN.example.com., nas.example.com")
+	t.Setenv("PANGOLIN_DIRECT_ORGS", "home")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inst := cfg.Pangolin[0]
+	if len(inst.DirectNames) != 2 || inst.DirectNames[0] != "*.lan.example.com" || inst.DirectNames[1] != "nas.example.com" {
+		t.Errorf("unexpected direct names %q", inst.DirectNames)
+	}
+	if len(inst.DirectOrgs) != 1 || inst.DirectOrgs[0] != "home" {
+		t.Errorf("unexpected direct orgs %q", inst.DirectOrgs)
+	}
+
+	t.Setenv("PANGOLIN_DIRECT_NAMES", "[lan")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for a malformed DIRECT_NAMES pattern")
+	}
+}
+
+func TestLoadConfig_PangolinSRV(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("PANGOLIN_SRV_DOMAIN", "Games.Example.com.")
+	t.Setenv("PANGOLIN_SRV_SERVICES", "MC Survival=minecraft, TeamSpeak=ts3")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inst := cfg.Pangolin[0]
+	if inst.SRVDomain != "games.example.com" {
+		t.Errorf("expected normalized SRV domain, got %q", inst.SRVDomain)
+	}
+	if inst.SRVServices["mc-survival"] != "minecraft" || inst.SRVServices["teamspeak"] != "ts3" {
+		t.Errorf("unexpected SRV services %v", inst.SRVServices)
+	}
+
+	t.Setenv("PANGOLIN_SRV_SERVICES", "minecraft")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for an SRV_SERVICES entry without a service")
+	}
+}
+
+func TestLoadConfig_HTTPSRecords(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.HTTPSRecords != HTTPSNoData || len(cfg.HTTPSALPN) != 2 || cfg.HTTPSALPN[1] != "http/1.1" {
+		t.Errorf("unexpected defaults %q %q", cfg.HTTPSRecords, cfg.HTTPSALPN)
+	}
+
+	t.Setenv("HTTPS_RECORDS", "forward")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for an unknown HTTPS_RECORDS mode")
+	}
+}
+
+func TestLoadConfig_ForwardRules(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("FORWARD_RULES", "corp,tailscale")
+	t.Setenv("FORWARD_CORP_DOMAINS", "Corp.Example.Internal, *.home.arpa")
+	t.Setenv("FORWARD_CORP_UPSTREAMS", "10.0.0.10, 10.0.0.11:5353")
+	t.Setenv("FORWARD_TAILSCALE_DOMAINS", "ts.net")
+	t.Setenv("FORWARD_TAILSCALE_UPSTREAMS", "100.100.100.100")
+	t.Setenv("FORWARD_TAILSCALE_PROTOCOL", "tls")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.ForwardRules) != 2 {
+		t.Fatalf("expected 2 rules, got %+v", cfg.ForwardRules)
+	}
+	corp, ts := cfg.ForwardRules[0], cfg.ForwardRules[1]
+	if len(corp.Domains) != 2 || corp.Domains[0] != "corp.example.internal." || corp.Domains[1] != "home.arpa." {
+		t.Errorf("unexpected domains %q", corp.Domains)
+	}
+	if len(corp.Upstreams) != 2 || corp.Upstreams[0] != "10.0.0.10:53" || corp.Upstreams[1] != "10.0.0.11:5353" {
+		t.Errorf("unexpected upstreams %q", corp.Upstreams)
+	}
+	if ts.Protocol != ForwardTLS || ts.Upstreams[0] != "100.100.100.100:853" {
+		t.Errorf("unexpected TLS rule %+v", ts)
+	}
+
+	t.Setenv("FORWARD_TAILSCALE_PROTOCOL", "https")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for an unknown protocol")
+	}
+	t.Setenv("FORWARD_TAILSCALE_PROTOCOL", "")
+	t.Setenv("FORWARD_TAILSCALE_UPSTREAMS", "")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for a rule without upstreams")
+	}
+}
+
+func TestLoadConfig_Blocklists(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("BLOCKLISTS", "https://example.com/hosts, /etc/blocklist.txt")
+	t.Setenv("ALLOWLIST", "cdn.example.com")
+	t.Setenv("BLOCK_RESPONSE", "null")
+	t.Setenv("CLIENT_GROUPS", "kids,servers")
+	t.Setenv("CLIENT_GROUP_KIDS_NETWORKS", "192.168.10.0/24, 192.168.11.7")
+	t.Setenv("CLIENT_GROUP_SERVERS_NETWORKS", "10.0.0.0/8")
+	t.Setenv("CLIENT_GROUP_SERVERS_BLOCKING", "false")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Blocklists) != 2 || cfg.BlocklistRefresh.Hours() != 24 || cfg.BlockResponse != BlockNull || !cfg.Blocking {
+		t.Errorf("unexpected blocklist config %q %s %q %v", cfg.Blocklists, cfg.BlocklistRefresh, cfg.BlockResponse, cfg.Blocking)
+	}
+	if len(cfg.ClientGroups) != 2 {
+		t.Fatalf("expected 2 client groups, got %+v", cfg.ClientGroups)
+	}
+	kids, servers := cfg.ClientGroups[0], cfg.ClientGroups[1]
+	if len(kids.Networks) != 2 || kids.Networks[1].String() != "192.168.11.7/32" || !kids.Blocking {
+		t.Errorf("unexpected kids group %+v", kids)
+	}
+	if servers.Blocking {
+		t.Errorf("expected blocking disabled for servers, got %+v", servers)
+	}
+
+	t.Setenv("BLOCK_RESPONSE", "drop")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for an unknown block response")
+	}
+	t.Setenv("BLOCK_RESPONSE", "")
+	t.Setenv("CLIENT_GROUP_KIDS_NETWORKS", "192.168.10.0/33")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for an invalid network")
+	}
+	t.Setenv("CLIENT_GROUP_KIDS_NETWORKS", "")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error for a group without networks")
+	}
+}
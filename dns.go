@@ -4,15 +4,25 @@ import (
 	"context"
 	"log"
 	"net"
+	"net/netip"
 	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
+// Answers to HTTPS and SVCB queries for local names.
+const (
+	HTTPSNoData     = "nodata"     // no records, so clients fall back to A
+	HTTPSSynthesize = "synthesize" // a record with the local addresses as hints
+)
+
 type DNSServer struct {
 	cfg       *Config
 	store     *RecordStore
+	prober    *UpstreamProber // orders upstreams by health, if set
+	targets   *TargetProber   // local IPs to forward instead of answering, if set
+	blocker   *Blocker        // answers queries for blocked names, if set
 	udpServer *dns.Server
 	tcpServer *dns.Server
 }
@@ -21,8 +31,29 @@ func NewDNSServer(cfg *Config, store *RecordStore) *DNSServer {
 	return &DNSServer{cfg: cfg, store: store}
 }
 
+// UseProber makes forwarding prefer upstreams the prober reports healthy.
+func (s *DNSServer) UseProber(prober *UpstreamProber) {
+	s.prober = prober
+}
+
+// UseTargets makes names mapped to an unreachable local IP be forwarded
+// upstream instead of answered locally.
+func (s *DNSServer) UseTargets(targets *TargetProber) {
+	s.targets = targets
+}
+
+// UseBlocker makes queries for blocked names be answered with the block
+// response instead of being forwarded.
+func (s *DNSServer) UseBlocker(blocker *Blocker) {
+	s.blocker = blocker
+}
+
 // ServeDNS handles incoming DNS queries.
 func (s *DNSServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if s.block(w, r) {
+		return
+	}
+
 	msg := new(dns.Msg)
 	msg.SetReply(r)
 	msg.Authoritative = true
@@ -31,21 +62,60 @@ func (s *DNSServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 		switch q.Qtype {
 		case dns.TypeA:
 			fqdn := strings.ToLower(q.Name)
-			if ip, ok := s.store.Lookup(fqdn); ok {
-				msg.Answer = append(msg.Answer, &dns.A{
-					Hdr: dns.RR_Header{
-						Name:   q.Name,
-						Rrtype: dns.TypeA,
-						Class:  dns.ClassINET,
-						Ttl:    60,
-					},
-					A: net.ParseIP(ip),
-				})
-				log.Printf("dns: %s -> %s (local)", q.Name, ip)
+			ips, ok := s.store.LookupAll(fqdn)
+			if ok {
+				ips = s.reachable(q.Name, ips)
+				ok = len(ips) > 0
+			}
+			if ok {
+				for _, ip := range ips {
+					msg.Answer = append(msg.Answer, aRecord(q.Name, ip))
+				}
+				log.Printf("dns: %s -> %s (local)", q.Name, strings.Join(ips, ","))
 			} else {
 				s.forward(w, r)
 				return
 			}
+		case dns.TypeHTTPS, dns.TypeSVCB:
+			// Upstream answers may carry address hints of the public IP,
+			// undermining the local A answer, so local names never go
+			// upstream. Names forwarded for A are forwarded here too.
+			ips, ok := s.store.LookupAll(strings.ToLower(q.Name))
+			if ok {
+				ips = s.reachable(q.Name, ips)
+				ok = len(ips) > 0
+			}
+			if !ok {
+				s.forward(w, r)
+				return
+			}
+			if s.cfg.HTTPSRecords == HTTPSSynthesize {
+				msg.Answer = append(msg.Answer, s.svcbRecord(q.Name, q.Qtype, ips))
+				log.Printf("dns: %s %s -> %s (synthesized)", q.Name, dns.TypeToString[q.Qtype], strings.Join(ips, ","))
+			}
+		case dns.TypeSRV:
+			srv, ok := s.store.LookupSRV(strings.ToLower(q.Name))
+			if !ok {
+				s.forward(w, r)
+				return
+			}
+			msg.Answer = append(msg.Answer, &dns.SRV{
+				Hdr: dns.RR_Header{
+					Name:   q.Name,
+					Rrtype: dns.TypeSRV,
+					Class:  dns.ClassINET,
+					Ttl:    60,
+				},
+				Port:   srv.Port,
+				Target: srv.Target,
+			})
+			// Save the client a lookup of the target if it is local, too.
+			if ips, ok := s.store.LookupAll(srv.Target); ok {
+				for _, ip := range s.reachable(srv.Target, ips) {
+					msg.Extra = append(msg.Extra, aRecord(srv.Target, ip))
+				}
+			}
+			log.Printf("dns: %s -> %s:%d (local)", q.Name, srv.Target, srv.Port)
 		default:
 			s.forward(w, r)
 			return
@@ -55,7 +125,101 @@ func (s *DNSServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	w.WriteMsg(msg)
 }
 
-// forward sends the query to the upstream DNS server and relays the response.
+// block answers r with the block response if its name is blocked for the
+// client, reporting whether it did. Local names are never blocked.
+func (s *DNSServer) block(w dns.ResponseWriter, r *dns.Msg) bool {
+	if s.blocker == nil || len(r.Question) == 0 {
+		return false
+	}
+	name := r.Question[0].Name
+	if s.store.Has(strings.ToLower(name)) {
+		return false
+	}
+
+	var client netip.Addr
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		client = addr.AddrPort().Addr()
+	case *net.TCPAddr:
+		client = addr.AddrPort().Addr()
+	}
+	group, blocked := s.blocker.Blocked(name, client)
+	if !blocked {
+		return false
+	}
+	log.Printf("dns: %s blocked for %s (%s)", name, client, group)
+	w.WriteMsg(s.blocker.Response(r))
+	return true
+}
+
+// aRecord returns an A record of name for ip.
+func aRecord(name, ip string) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		A: net.ParseIP(ip),
+	}
+}
+
+// svcbRecord returns a ServiceMode HTTPS or SVCB record of name with the
+// configured ALPN protocols and ips as address hints.
+func (s *DNSServer) svcbRecord(name string, qtype uint16, ips []string) dns.RR {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		addr := net.ParseIP(ip)
+		if addr.To4() != nil {
+			v4 = append(v4, addr.To4())
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+
+	svcb := dns.SVCB{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: qtype,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		Priority: 1,
+		Target:   ".",
+		Value:    []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: s.cfg.HTTPSALPN}},
+	}
+	if len(v4) > 0 {
+		svcb.Value = append(svcb.Value, &dns.SVCBIPv4Hint{Hint: v4})
+	}
+	if len(v6) > 0 {
+		svcb.Value = append(svcb.Value, &dns.SVCBIPv6Hint{Hint: v6})
+	}
+	if qtype == dns.TypeHTTPS {
+		return &dns.HTTPS{SVCB: svcb}
+	}
+	return &svcb
+}
+
+// reachable returns the IPs of name that the target prober does not report
+// unreachable.
+func (s *DNSServer) reachable(name string, ips []string) []string {
+	healthy := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if s.targets.Healthy(ip) {
+			healthy = append(healthy, ip)
+		}
+	}
+	if len(healthy) == 0 {
+		log.Printf("dns: %s -> %s is unreachable, forwarding", name, strings.Join(ips, ","))
+	}
+	return healthy
+}
+
+// forward sends the query to the upstream DNS servers and relays the first
+// response. Upstreams are tried in order, healthy ones first. Queries for
+// names matching a forwarding rule go to the upstreams of the rule with the
+// longest matching domain instead.
 func (s *DNSServer) forward(w dns.ResponseWriter, r *dns.Msg) {
 	client := new(dns.Client)
 
@@ -64,16 +228,32 @@ func (s *DNSServer) forward(w dns.ResponseWriter, r *dns.Msg) {
 		client.Net = "tcp"
 	}
 
-	resp, _, err := client.Exchange(r, s.cfg.UpstreamDNS)
-	if err != nil {
-		log.Printf("dns: upstream error for %s: %v", r.Question[0].Name, err)
-		msg := new(dns.Msg)
-		msg.SetRcode(r, dns.RcodeServerFailure)
-		w.WriteMsg(msg)
-		return
+	upstreams := splitUpstreams(s.cfg.UpstreamDNS)
+	if rule := matchForwardRule(s.cfg.ForwardRules, r.Question[0].Name); rule != nil {
+		upstreams = rule.Upstreams
+		switch rule.Protocol {
+		case ForwardUDP:
+			client.Net = ""
+		case ForwardTCP:
+			client.Net = "tcp"
+		case ForwardTLS:
+			client.Net = "tcp-tls"
+		}
 	}
 
-	w.WriteMsg(resp)
+	var err error
+	for _, upstream := range s.prober.orderedUpstreams(upstreams) {
+		var resp *dns.Msg
+		if resp, _, err = client.Exchange(r, upstream); err == nil {
+			w.WriteMsg(resp)
+			return
+		}
+		log.Printf("dns: upstream %s error for %s: %v", upstream, r.Question[0].Name, err)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetRcode(r, dns.RcodeServerFailure)
+	w.WriteMsg(msg)
 }
 
 // ListenAndServe starts both UDP and TCP DNS listeners and blocks until ctx is
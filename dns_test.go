@@ -2,6 +2,7 @@ package main
 
 import (
 	"net"
+	"sync/atomic"
 	"testing"
 
 	"github.com/miekg/dns"
@@ -108,3 +109,88 @@ func TestDNSServer_UnknownDomain_AttemptsForward(t *testing.T) {
 		t.Errorf("expected SERVFAIL for forward error, got rcode %d", w.msg.Rcode)
 	}
 }
+
+func TestDNSServer_MultipleAddresses(t *testing.T) {
+	srv := newTestDNSServer(nil)
+	srv.store.UpdateSource("test", 0, 1, []Record{
+		{Name: "nas.example.com.", IP: "192.168.1.20", IPs: []string{"192.168.1.20", "192.168.1.21"}},
+	})
+
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("nas.example.com", dns.TypeA))
+	if len(w.msg.Answer) != 2 {
+		t.Fatalf("expected 2 answers, got %v", w.msg.Answer)
+	}
+	for i, want := range []string{"192.168.1.20", "192.168.1.21"} {
+		if a := w.msg.Answer[i].(*dns.A); a.A.String() != want {
+			t.Errorf("answer %d: expected %s, got %s", i, want, a.A)
+		}
+	}
+}
+
+func TestDNSServer_SRV(t *testing.T) {
+	srv := newTestDNSServer(nil)
+	srv.store.UpdateSource("test", 0, 1, []Record{
+		{Name: "mc.example.com.", IP: "10.0.0.5"},
+		{Name: "_minecraft._tcp.mc.example.com.", SRV: &SRV{Target: "mc.example.com.", Port: 25565}},
+	})
+
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("_minecraft._tcp.mc.example.com", dns.TypeSRV))
+	if len(w.msg.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %v", w.msg.Answer)
+	}
+	rr, ok := w.msg.Answer[0].(*dns.SRV)
+	if !ok || rr.Target != "mc.example.com." || rr.Port != 25565 {
+		t.Errorf("unexpected SRV answer %v", w.msg.Answer[0])
+	}
+	if len(w.msg.Extra) != 1 || w.msg.Extra[0].(*dns.A).A.String() != "10.0.0.5" {
+		t.Errorf("expected the target address as additional record, got %v", w.msg.Extra)
+	}
+}
+
+func TestDNSServer_HTTPSRecords(t *testing.T) {
+	var rcode atomic.Int32
+	rcode.Store(dns.RcodeNameError) // tells forwarded queries apart
+	srv := newTestDNSServer(nil)
+	srv.cfg.UpstreamDNS = startTestUpstream(t, &rcode)
+	srv.store.UpdateSource("test", 0, 1, []Record{
+		{Name: "app.example.com.", IP: "10.0.0.5", IPs: []string{"10.0.0.5", "fd00::5"}},
+	})
+
+	// NODATA by default.
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("app.example.com", dns.TypeHTTPS))
+	if w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 0 {
+		t.Errorf("expected NODATA for a local name, got %v", w.msg)
+	}
+
+	srv.cfg.HTTPSRecords = HTTPSSynthesize
+	srv.cfg.HTTPSALPN = []string{"h2", "http/1.1"}
+	w = &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("app.example.com", dns.TypeHTTPS))
+	if len(w.msg.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %v", w.msg.Answer)
+	}
+	rr, ok := w.msg.Answer[0].(*dns.HTTPS)
+	if !ok {
+		t.Fatalf("answer is not an HTTPS record: %v", w.msg.Answer[0])
+	}
+	want := `app.example.com.	60	IN	HTTPS	1 . alpn="h2,http/1.1" ipv4hint="10.0.0.5" ipv6hint="fd00::5"`
+	if rr.String() != want {
+		t.Errorf("unexpected record\n got: %s\nwant: %s", rr, want)
+	}
+
+	w = &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("app.example.com", dns.TypeSVCB))
+	if len(w.msg.Answer) != 1 || w.msg.Answer[0].Header().Rrtype != dns.TypeSVCB {
+		t.Errorf("expected a synthesized SVCB record, got %v", w.msg.Answer)
+	}
+
+	// Other names go upstream.
+	w = &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("other.example.com", dns.TypeHTTPS))
+	if w.msg.Rcode != dns.RcodeNameError {
+		t.Errorf("expected a non-local name to be forwarded, got %v", w.msg)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DockerSource discovers hostnames declared via container labels through the
+// Docker Engine API on a unix socket, e.g.
+//
+//	pangolin-dns.host=app.example.com,app2.example.com
+//
+// It implements Watcher so container starts and stops are picked up from the
+// events stream without waiting for the next poll.
+type DockerSource struct {
+	label   string
+	localIP string
+	client  *http.Client // for regular requests, with timeout
+	stream  *http.Client // for the events stream, without timeout
+}
+
+// dockerContainer is the subset of a container returned by /containers/json.
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// dockerEvent is the subset of an event returned by /events.
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID string `json:"ID"`
+	} `json:"Actor"`
+}
+
+// dockerEventActions are the container events that can change the set of
+// published names.
+var dockerEventActions = []string{"start", "die", "stop", "destroy"}
+
+func NewDockerSource(socket, label, localIP string) *DockerSource {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &DockerSource{
+		label:   label,
+		localIP: localIP,
+		client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		stream:  &http.Client{Transport: transport},
+	}
+}
+
+func (d *DockerSource) Name() string { return "docker" }
+
+// Fetch returns one record per hostname listed in the label of a running
+// container.
+func (d *DockerSource) Fetch(ctx context.Context) ([]Record, error) {
+	path := "/containers/json?filters=" + url.QueryEscape(dockerFilters(map[string][]string{"label": {d.label}}))
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET /containers/json: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /containers/json: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var containers []dockerContainer
+	if err := json.Unmarshal(body, &containers); err != nil {
+		return nil, fmt.Errorf("parse containers response: %w", err)
+	}
+
+	records := make([]Record, 0)
+	for _, c := range containers {
+		name := strings.TrimPrefix(strings.Join(c.Names, ","), "/")
+		for _, host := range strings.Split(c.Labels[d.label], ",") {
+			host = strings.TrimSpace(host)
+			if host == "" {
+				continue
+			}
+			records = append(records, Record{
+				Name: host,
+				IP:   d.localIP,
+				Meta: map[string]string{"container": name},
+			})
+		}
+	}
+	return records, nil
+}
+
+// Watch streams container events and calls changed for every start or stop.
+// It blocks until ctx is cancelled or the stream ends.
+func (d *DockerSource) Watch(ctx context.Context, changed func()) error {
+	filters := dockerFilters(map[string][]string{
+		"type":  {"container"},
+		"event": dockerEventActions,
+		"label": {d.label},
+	})
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://docker/events?filters="+url.QueryEscape(filters), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("GET /events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("GET /events: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev dockerEvent
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("read events: %w", err)
+		}
+		if ev.Type == "container" {
+			changed()
+		}
+	}
+}
+
+// dockerFilters encodes Docker API filters as JSON.
+func dockerFilters(f map[string][]string) string {
+	b, _ := json.Marshal(f)
+	return string(b)
+}
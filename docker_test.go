@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newFakeDockerSocket serves handler on a unix socket in a temp dir and
+// returns the socket path.
+func newFakeDockerSocket(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen on unix socket: %v", err)
+	}
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return socket
+}
+
+func TestDockerSource_Fetch(t *testing.T) {
+	var gotFilters string
+	socket := newFakeDockerSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		gotFilters = r.URL.Query().Get("filters")
+		json.NewEncoder(w).Encode([]dockerContainer{
+			{ID: "a", Names: []string{"/app"}, Labels: map[string]string{"pangolin-dns.host": "app.example.com, api.example.com"}},
+			{ID: "b", Names: []string{"/empty"}, Labels: map[string]string{"pangolin-dns.host": ""}},
+		})
+	}))
+
+	records, err := NewDockerSource(socket, "pangolin-dns.host", "10.0.0.3").Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotFilters != `{"label":["pangolin-dns.host"]}` {
+		t.Errorf("unexpected filters %q", gotFilters)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d: %+v", len(records), records)
+	}
+	for i, want := range []string{"app.example.com", "api.example.com"} {
+		if records[i].Name != want || records[i].IP != "10.0.0.3" {
+			t.Errorf("record %d = %+v, want %s -> 10.0.0.3", i, records[i], want)
+		}
+		if records[i].Meta["container"] != "app" {
+			t.Errorf("expected container metadata, got %v", records[i].Meta)
+		}
+	}
+}
+
+func TestDockerSource_WatchNotifiesOnEvents(t *testing.T) {
+	socket := newFakeDockerSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			http.NotFound(w, r)
+			return
+		}
+		enc := json.NewEncoder(w)
+		enc.Encode(dockerEvent{Type: "container", Action: "start"})
+		enc.Encode(dockerEvent{Type: "container", Action: "die"})
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewDockerSource(socket, "pangolin-dns.host", "10.0.0.3").Watch(ctx, func() { changes <- struct{}{} })
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected change notification %d", i+1)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected nil error after cancel, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch did not return after context cancellation")
+	}
+}
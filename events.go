@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Event types published on the EventBus.
+const (
+	EventChanges = "changes" // records of a source were added, removed or changed
+	EventPoll    = "poll"    // a source finished a poll, successfully or not
+	EventTarget  = "target"  // a local target IP became reachable or unreachable
+)
+
+// Event is something observers such as webhooks may want to react to.
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source,omitempty"`
+	Changes  []Change  `json:"changes,omitempty"`  // changes only
+	Initial  bool      `json:"initial,omitempty"`  // changes: first records of the source since startup
+	Records  int       `json:"records,omitempty"`  // poll: records published
+	Error    string    `json:"error,omitempty"`    // poll: fetch error; target: probe error
+	Failures int64     `json:"failures,omitempty"` // poll: consecutive failed polls
+	Target   string    `json:"target,omitempty"`   // target: local IP
+	State    string    `json:"state,omitempty"`    // target: TargetUp or TargetDown
+}
+
+// EventBus fans out events to subscribers. Publishing never blocks: events
+// for a subscriber whose buffer is full are dropped and logged, or, for a
+// strict subscriber, its subscription is cancelled.
+type EventBus struct {
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]*subscriber
+}
+
+type subscriber struct {
+	ch     chan Event
+	strict bool // cancelled instead of dropping events when its buffer is full
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[int]*subscriber)}
+}
+
+// Subscribe returns a channel receiving all events published from now on and
+// a function that cancels the subscription and closes the channel.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	return b.subscribe(buffer, false)
+}
+
+// SubscribeStrict is like Subscribe, but if the subscriber falls behind, the
+// bus cancels the subscription instead of dropping single events, so a
+// closed channel tells it that it missed events and has to resync.
+func (b *EventBus) SubscribeStrict(buffer int) (<-chan Event, func()) {
+	return b.subscribe(buffer, true)
+}
+
+func (b *EventBus) subscribe(buffer int, strict bool) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Event, buffer)
+	b.subs[id] = &subscriber{ch: ch, strict: strict}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.cancel(id)
+	}
+}
+
+// cancel removes a subscriber and closes its channel, unless it is already
+// gone. b.mu must be held.
+func (b *EventBus) cancel(id int) {
+	if sub, ok := b.subs[id]; ok {
+		delete(b.subs, id)
+		close(sub.ch)
+	}
+}
+
+// Publish sends e to all subscribers.
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, sub := range b.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			if sub.strict {
+				log.Printf("events: subscriber too slow, cancelling its subscription at %s event", e.Type)
+				b.cancel(id)
+				continue
+			}
+			log.Printf("events: subscriber too slow, dropping %s event", e.Type)
+		}
+	}
+}
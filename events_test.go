@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventBus_FansOutToSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	a, cancelA := bus.Subscribe(1)
+	b, cancelB := bus.Subscribe(1)
+	defer cancelB()
+
+	bus.Publish(Event{Type: EventPoll, Source: "docker"})
+	for _, ch := range []<-chan Event{a, b} {
+		ev := <-ch
+		if ev.Type != EventPoll || ev.Source != "docker" || ev.Time.IsZero() {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	}
+
+	cancelA()
+	cancelA() // idempotent
+	if _, ok := <-a; ok {
+		t.Error("expected channel to be closed after cancel")
+	}
+	bus.Publish(Event{Type: EventPoll}) // must not send on the closed channel
+}
+
+func TestEventBus_DropsForSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	ch, cancel := bus.Subscribe(1)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		bus.Publish(Event{Type: EventPoll, Source: "first"})
+		bus.Publish(Event{Type: EventPoll, Source: "second"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full subscriber")
+	}
+	if ev := <-ch; ev.Source != "first" {
+		t.Errorf("expected first event to be kept, got %q", ev.Source)
+	}
+}
+
+func TestEventBus_CancelsSlowStrictSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	ch, cancel := bus.SubscribeStrict(1)
+
+	bus.Publish(Event{Type: EventPoll, Source: "first"})
+	bus.Publish(Event{Type: EventPoll, Source: "second"})
+	if ev := <-ch; ev.Source != "first" {
+		t.Errorf("expected first event to be kept, got %q", ev.Source)
+	}
+	if ev, ok := <-ch; ok {
+		t.Errorf("expected channel to be closed after falling behind, got %+v", ev)
+	}
+	cancel() // must not close the channel again
+	bus.Publish(Event{Type: EventPoll})
+}
+
+func TestRecordStore_PublishesChanges(t *testing.T) {
+	store := NewRecordStore()
+	ch, cancel := store.Events().Subscribe(10)
+	defer cancel()
+
+	store.UpdateSource("docker", 50, 1, []Record{{Name: "a.example.com.", IP: "10.0.0.1", Source: "docker"}})
+	store.UpdateSource("docker", 50, 2, []Record{{Name: "a.example.com.", IP: "10.0.0.1", Source: "docker"}})
+
+	ev := <-ch
+	if ev.Type != EventChanges || ev.Source != "docker" || len(ev.Changes) != 1 || ev.Changes[0].Type != ChangeAdded || !ev.Initial {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("expected no event for an unchanged update, got %+v", ev)
+	default:
+	}
+
+	store.UpdateSource("docker", 50, 3, []Record{{Name: "a.example.com.", IP: "10.0.0.2", Source: "docker"}})
+	if ev := <-ch; ev.Initial {
+		t.Errorf("expected a later change not to be initial, got %+v", ev)
+	}
+}
+
+func TestPoller_PublishesPollEvents(t *testing.T) {
+	store := NewRecordStore()
+	ch, cancel := store.Events().Subscribe(10)
+	defer cancel()
+
+	src := &fakeSource{name: "fake", err: errors.New("boom")}
+	p := NewSourcePoller(&Config{}, src, store, time.Minute, 50)
+	p.Poll(context.Background())
+	p.Poll(context.Background())
+
+	for want := int64(1); want <= 2; want++ {
+		ev := <-ch
+		if ev.Type != EventPoll || ev.Error != "boom" || ev.Failures != want {
+			t.Errorf("unexpected event %+v, want failure %d", ev, want)
+		}
+	}
+
+	src.err = nil
+	src.records = []Record{{Name: "a.example.com", IP: "10.0.0.1"}}
+	p.Poll(context.Background())
+	var poll Event
+	for ev := range ch {
+		if ev.Type == EventPoll {
+			poll = ev
+			break
+		}
+	}
+	if poll.Error != "" || poll.Failures != 0 || poll.Records != 1 {
+		t.Errorf("unexpected success event %+v", poll)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+)
+
+// Protocols a forwarding rule can use to reach its upstreams.
+const (
+	ForwardUDP = "udp"
+	ForwardTCP = "tcp"
+	ForwardTLS = "tls" // DNS over TLS
+)
+
+// ForwardRule sends queries for names under one of its domains to its own
+// upstream DNS servers instead of UpstreamDNS.
+type ForwardRule struct {
+	Name      string
+	Domains   []string // FQDNs (with trailing dot) matching themselves and all names below
+	Upstreams []string // tried in order
+	Protocol  string   // ForwardUDP, ForwardTCP or ForwardTLS; empty to use the client's
+}
+
+// matchForwardRule returns the rule with the longest domain that name equals
+// or lies below, or nil if none matches.
+func matchForwardRule(rules []ForwardRule, name string) *ForwardRule {
+	name = normalizeName(name)
+
+	var match *ForwardRule
+	longest := 0
+	for i, rule := range rules {
+		for _, domain := range rule.Domains {
+			if len(domain) <= longest {
+				continue
+			}
+			if name == domain || strings.HasSuffix(name, "."+domain) {
+				match, longest = &rules[i], len(domain)
+			}
+		}
+	}
+	return match
+}
+
+// normalizeForwardDomain turns a configured rule domain such as
+// "*.home.arpa" or "Corp.Example.Internal" into a lowercase FQDN.
+func normalizeForwardDomain(domain string) string {
+	return normalizeName(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestMatchForwardRule_LongestSuffix(t *testing.T) {
+	rules := []ForwardRule{
+		{Name: "corp", Domains: []string{"example.internal."}},
+		{Name: "ad", Domains: []string{"corp.example.internal."}},
+		{Name: "lan", Domains: []string{"home.arpa.", "ts.net."}},
+	}
+	cases := map[string]string{
+		"dc1.corp.example.internal.": "ad",
+		"corp.example.internal":      "ad",
+		"wiki.example.internal.":     "corp",
+		"NAS.Home.Arpa.":             "lan",
+		"host.tail1234.ts.net.":      "lan",
+		"notts.net.":                 "",
+		"example.com.":               "",
+	}
+	for name, want := range cases {
+		got := ""
+		if rule := matchForwardRule(rules, name); rule != nil {
+			got = rule.Name
+		}
+		if got != want {
+			t.Errorf("%s: expected rule %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestDNSServer_ForwardsByRule(t *testing.T) {
+	var public, corp atomic.Int32
+	corp.Store(dns.RcodeNameError) // tells the upstreams apart
+	srv := newTestDNSServer(map[string]string{"app.corp.example.internal.": "10.0.0.5"})
+	srv.cfg.UpstreamDNS = startTestUpstream(t, &public)
+	srv.cfg.ForwardRules = []ForwardRule{{
+		Name:      "corp",
+		Domains:   []string{"corp.example.internal."},
+		Upstreams: []string{startTestUpstream(t, &corp)},
+		Protocol:  ForwardUDP,
+	}}
+
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("dc1.corp.example.internal", dns.TypeA))
+	if w.msg.Rcode != dns.RcodeNameError {
+		t.Errorf("expected the rule's upstream to answer, got %v", w.msg)
+	}
+
+	w = &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("example.com", dns.TypeA))
+	if w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 1 {
+		t.Errorf("expected the default upstream to answer, got %v", w.msg)
+	}
+
+	// Local names take precedence over rules.
+	w = &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("app.corp.example.internal", dns.TypeA))
+	if len(w.msg.Answer) != 1 || w.msg.Answer[0].(*dns.A).A.String() != "10.0.0.5" {
+		t.Errorf("expected the local answer, got %v", w.msg)
+	}
+}
@@ -3,37 +3,148 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 )
 
 type HealthServer struct {
-	cfg    *Config
-	poller *Poller
-	store  *RecordStore
+	cfg     *Config
+	pollers []*Poller
+	store   *RecordStore
+	ctx     context.Context // server lifetime; bounds manual polls
+	push    *debouncer      // debounces refreshes requested via /push
+	certs   *CertReloader   // serves TLS if set
+	prober  *UpstreamProber // reports upstream health, if set
+	targets *TargetProber   // reports local target reachability, if set
+	blocker *Blocker        // reports blocklists and blocked queries, if set
+	started time.Time
 }
 
-func NewHealthServer(cfg *Config, poller *Poller, store *RecordStore) *HealthServer {
-	return &HealthServer{cfg: cfg, poller: poller, store: store}
+func NewHealthServer(cfg *Config, pollers []*Poller, store *RecordStore) *HealthServer {
+	return &HealthServer{
+		cfg:     cfg,
+		pollers: pollers,
+		store:   store,
+		ctx:     context.Background(),
+		push:    newDebouncer(cfg.PushDebounce),
+		started: time.Now(),
+	}
 }
 
 type healthResponse struct {
-	Status     string `json:"status"`
-	Records    int    `json:"records"`
-	LastPoll   string `json:"last_poll,omitempty"`
-	PollErrors int64  `json:"poll_errors"`
+	Status     string           `json:"status"` // StatusOK, StatusDegraded or StatusNotReady
+	Records    int              `json:"records"`
+	LastPoll   string           `json:"last_poll,omitempty"`
+	PollErrors int64            `json:"poll_errors"`
+	Sources    []sourceHealth   `json:"sources"`
+	Upstreams  []UpstreamStatus `json:"upstreams,omitempty"`
+	Targets    []TargetStatus   `json:"targets,omitempty"`
+	Blocklist  *BlocklistStatus `json:"blocklist,omitempty"`
+	Checks     []checkResult    `json:"checks"`
+}
+
+// sourceHealth reports the poll state of a single discovery source.
+type sourceHealth struct {
+	Name           string    `json:"name"`
+	LastPoll       string    `json:"last_poll,omitempty"`
+	PollErrors     int64     `json:"poll_errors"`
+	PollDurationMS int64     `json:"poll_duration_ms"`
+	Generation     uint64    `json:"generation"`     // number of polls started
+	Orgs           []OrgStat `json:"orgs,omitempty"` // Pangolin only
+}
+
+// pollResponse is the health status returned by /poll, with the outcome of
+// the triggered poll per source.
+type pollResponse struct {
+	healthResponse
+	Polls []pollResult `json:"polls"`
+}
+
+type pollResult struct {
+	Source string `json:"source"`
+	Action string `json:"action"` // "started" a new poll or "joined" one in flight
+	Error  string `json:"error,omitempty"`
+}
+
+// UseTLS makes the server serve HTTPS with the given certificates. If they
+// verify client certificates, the admin API requires one.
+func (h *HealthServer) UseTLS(certs *CertReloader) {
+	h.certs = certs
 }
 
+// UseProber includes the upstream probe results in health, readiness and
+// metrics.
+func (h *HealthServer) UseProber(prober *UpstreamProber) {
+	h.prober = prober
+}
+
+// UseTargets includes the local target reachability in health, readiness
+// and metrics.
+func (h *HealthServer) UseTargets(targets *TargetProber) {
+	h.targets = targets
+}
+
+// UseBlocker includes the blocklists and blocked-query counters in health
+// and metrics.
+func (h *HealthServer) UseBlocker(blocker *Blocker) {
+	h.blocker = blocker
+}
+
+// Run serves the health probe on HealthPort and the admin API either on the
+// same port or, if AdminAddr is set, on its own address, until ctx is
+// cancelled.
 func (h *HealthServer) Run(ctx context.Context) {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", h.handleHealth)
-	mux.HandleFunc("/poll", h.handlePoll)
-	mux.HandleFunc("/domains", h.handleDomains)
+	h.ctx = ctx
+
+	probe, admin := h.routes()
+	if h.cfg.AdminAddr == "" {
+		h.serve(ctx, "health", ":"+h.cfg.HealthPort, probe)
+		return
+	}
+	go h.serve(ctx, "admin", h.cfg.AdminAddr, admin)
+	h.serve(ctx, "health", ":"+h.cfg.HealthPort, probe)
+}
 
+// routes returns the handlers of the health probe and the admin API. Without
+// a separate AdminAddr both are the same mux.
+func (h *HealthServer) routes() (probe, admin *http.ServeMux) {
+	probes := map[string]http.HandlerFunc{
+		"/healthz": h.handleHealth,
+		"/livez":   h.handleLive,
+		"/readyz":  h.handleReady,
+	}
+	probe = http.NewServeMux()
+	admin = probe
+	if h.cfg.AdminAddr != "" {
+		admin = http.NewServeMux()
+	}
+	for path, handler := range probes {
+		if !h.cfg.HealthAnonymous {
+			handler = h.require(roleRead, handler)
+		}
+		probe.HandleFunc(path, handler)
+		if admin != probe {
+			admin.HandleFunc(path, handler)
+		}
+	}
+
+	admin.HandleFunc("/poll", h.require(roleAdmin, h.handlePoll))
+	admin.HandleFunc("/domains", h.require(roleRead, h.handleDomains))
+	admin.HandleFunc("/changes", h.require(roleRead, h.handleChanges))
+	admin.HandleFunc("/events", h.require(roleRead, h.handleEvents))
+	admin.HandleFunc("/config", h.require(roleAdmin, h.handleConfig))
+	admin.HandleFunc("/metrics", h.require(roleRead, h.handleMetrics))
+	admin.HandleFunc("/push", h.handlePush) // authenticated by its own token or signature
+	return probe, admin
+}
+
+// serve runs an HTTP server on addr until ctx is cancelled.
+func (h *HealthServer) serve(ctx context.Context, name, addr string, handler http.Handler) {
 	srv := &http.Server{
-		Addr:    ":" + h.cfg.HealthPort,
-		Handler: mux,
+		Addr:    addr,
+		Handler: handler,
 	}
 
 	go func() {
@@ -43,28 +154,72 @@ func (h *HealthServer) Run(ctx context.Context) {
 		srv.Shutdown(shutCtx)
 	}()
 
-	log.Printf("health: listening on :%s/http", h.cfg.HealthPort)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("health: server error: %v", err)
+	var err error
+	if h.certs != nil {
+		srv.TLSConfig = h.certs.TLSConfig()
+		log.Printf("%s: listening on %s/https", name, addr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("%s: listening on %s/http", name, addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Printf("%s: server error: %v", name, err)
 	}
 }
 
+// handleHealth returns the detailed health status, with 503 unless all
+// checks pass.
 func (h *HealthServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := h.health()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode(resp.Status))
+	json.NewEncoder(w).Encode(resp)
+}
+
+// health collects the current health status of the store and all sources.
+func (h *HealthServer) health() healthResponse {
+	ready := h.readiness(time.Now())
 	resp := healthResponse{
-		Status:     "ok",
-		Records:    h.store.Count(),
-		PollErrors: h.poller.pollErrors.Load(),
-	}
-	if t := h.poller.lastPoll.Load(); t != nil {
-		resp.LastPoll = t.(time.Time).UTC().Format(time.RFC3339)
+		Status:    ready.Status,
+		Records:   h.store.Count(),
+		Sources:   make([]sourceHealth, 0, len(h.pollers)),
+		Upstreams: h.prober.Status(),
+		Targets:   h.targets.Status(),
+		Blocklist: h.blocker.Status(),
+		Checks:    ready.Checks,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	// Top-level fields aggregate all sources: total errors, most recent poll.
+	var lastPoll time.Time
+	for _, p := range h.pollers {
+		sh := sourceHealth{
+			Name:           p.src.Name(),
+			PollErrors:     p.pollErrors.Load(),
+			PollDurationMS: time.Duration(p.lastDuration.Load()).Milliseconds(),
+			Generation:     p.generation.Load(),
+		}
+		if ps, ok := p.src.(*PangolinSource); ok {
+			sh.Orgs = ps.OrgStats()
+		}
+		if t := p.lastPoll.Load(); t != nil {
+			sh.LastPoll = t.(time.Time).UTC().Format(time.RFC3339)
+			if t.(time.Time).After(lastPoll) {
+				lastPoll = t.(time.Time)
+			}
+		}
+		resp.PollErrors += sh.PollErrors
+		resp.Sources = append(resp.Sources, sh)
+	}
+	if !lastPoll.IsZero() {
+		resp.LastPoll = lastPoll.UTC().Format(time.RFC3339)
+	}
+	return resp
 }
 
-// handlePoll triggers an immediate re-poll of the Pangolin API and returns
-// the updated health status. Only accepts POST requests.
+// handlePoll triggers an immediate re-poll of all discovery sources and
+// returns the updated health status, noting per source whether a new poll
+// was started or one already in flight was joined. Only accepts POST requests.
 func (h *HealthServer) handlePoll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -72,22 +227,151 @@ func (h *HealthServer) handlePoll(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Println("health: manual poll triggered")
-	h.poller.Poll()
+	polls := make([]pollResult, 0, len(h.pollers))
+	for _, p := range h.pollers {
+		// Polls are shared with the polling loop, so they must not be
+		// cancelled when this client disconnects; only shutdown cancels them.
+		started, err := p.PollCoalesced(h.ctx)
+		res := pollResult{Source: p.src.Name(), Action: "joined"}
+		if started {
+			res.Action = "started"
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		polls = append(polls, res)
+	}
 
-	h.handleHealth(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pollResponse{healthResponse: h.health(), Polls: polls})
 }
 
-// handleDomains returns the list of DNS records currently held in the store.
+// handleDomains returns the list of DNS records currently held in the store,
+// the records themselves with their source metadata, and the Pangolin
+// resource domains that were skipped along with the reason.
 func (h *HealthServer) handleDomains(w http.ResponseWriter, r *http.Request) {
 	type domainsResponse struct {
-		Domains []string `json:"domains"`
+		Domains []string          `json:"domains"`
+		Records []Record          `json:"records"`
+		Skipped []SkippedResource `json:"skipped"`
 	}
 
 	domains := h.store.Domains()
 	if domains == nil {
 		domains = []string{}
 	}
+	skipped := []SkippedResource{}
+	for _, p := range h.pollers {
+		if ps, ok := p.src.(*PangolinSource); ok {
+			skipped = append(skipped, ps.Skipped()...)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(domainsResponse{Domains: domains})
+	json.NewEncoder(w).Encode(domainsResponse{Domains: domains, Records: h.store.Records(), Skipped: skipped})
+}
+
+// handleConfig returns the effective configuration with all secrets
+// redacted.
+func (h *HealthServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.cfg)
+}
+
+// handleChanges returns the recent record changes, oldest first. The optional
+// "since" query parameter (RFC 3339) restricts the result to newer changes.
+func (h *HealthServer) handleChanges(w http.ResponseWriter, r *http.Request) {
+	type changesResponse struct {
+		Changes []Change `json:"changes"`
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	changes := h.store.Changes(since)
+	if changes == nil {
+		changes = []Change{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changesResponse{Changes: changes})
+}
+
+// eventsKeepAlive is how often /events sends a comment to keep idle
+// connections and proxies from timing out.
+const eventsKeepAlive = 30 * time.Second
+
+// snapshotEvent is the first event sent by /events, holding all records.
+type snapshotEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Records []Record  `json:"records"`
+}
+
+// handleEvents streams record changes and poll results as server-sent events.
+// The stream starts with a "snapshot" event holding the current records;
+// every following event is named after its type ("changes" or "poll").
+func (h *HealthServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before taking the snapshot so no change falls in between. A
+	// client too slow to keep up has its stream ended rather than silently
+	// missing events, so that it reconnects and starts from a new snapshot.
+	events, cancel := h.store.Events().SubscribeStrict(100)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	snapshot := snapshotEvent{Type: "snapshot", Time: time.Now(), Records: h.store.Records()}
+	if err := writeEvent(w, snapshot.Type, snapshot); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				log.Printf("health: /events client %s fell behind, ending its stream", r.RemoteAddr)
+				return
+			}
+			if err := writeEvent(w, ev.Type, ev); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes v as a server-sent event named name.
+func writeEvent(w http.ResponseWriter, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
 }
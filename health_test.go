@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthServer_PollReportsStartedOrJoined(t *testing.T) {
+	src := newBlockingSource()
+	poller := NewSourcePoller(newTestConfig(""), src, NewRecordStore(), time.Minute, 0)
+	h := NewHealthServer(newTestConfig(""), []*Poller{poller}, poller.store)
+
+	// A poll already in flight from the polling loop.
+	go poller.Poll(context.Background())
+	<-src.entered
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.handlePoll(rec, httptest.NewRequest(http.MethodPost, "/poll", nil))
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(src.release)
+	<-done
+
+	var resp pollResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Polls) != 1 || resp.Polls[0].Action != "joined" {
+		t.Errorf("expected the manual poll to join the in-flight poll, got %+v", resp.Polls)
+	}
+	if resp.Records != 2 { // record plus its local. prefix
+		t.Errorf("expected 2 records after poll, got %d", resp.Records)
+	}
+
+	// With nothing in flight, a manual poll starts a new one.
+	rec = httptest.NewRecorder()
+	h.handlePoll(rec, httptest.NewRequest(http.MethodPost, "/poll", nil))
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Polls) != 1 || resp.Polls[0].Action != "started" {
+		t.Errorf("expected the manual poll to start a new poll, got %+v", resp.Polls)
+	}
+}
+
+func TestHealthServer_PollRejectsGet(t *testing.T) {
+	h := NewHealthServer(newTestConfig(""), nil, NewRecordStore())
+	rec := httptest.NewRecorder()
+	h.handlePoll(rec, httptest.NewRequest(http.MethodGet, "/poll", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestHealthServer_Changes(t *testing.T) {
+	store := NewRecordStore()
+	store.UpdateSource("pangolin", 0, 1, []Record{{Name: "a.example.com.", IP: "10.0.0.1", Source: "pangolin"}})
+	h := NewHealthServer(newTestConfig(""), nil, store)
+
+	rec := httptest.NewRecorder()
+	h.handleChanges(rec, httptest.NewRequest(http.MethodGet, "/changes", nil))
+
+	var resp struct {
+		Changes []Change `json:"changes"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Changes) != 1 || resp.Changes[0].Type != ChangeAdded {
+		t.Errorf("expected one added change, got %+v", resp.Changes)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec = httptest.NewRecorder()
+	h.handleChanges(rec, httptest.NewRequest(http.MethodGet, "/changes?since="+future, nil))
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Changes) != 0 {
+		t.Errorf("expected no changes after since, got %+v", resp.Changes)
+	}
+
+	rec = httptest.NewRecorder()
+	h.handleChanges(rec, httptest.NewRequest(http.MethodGet, "/changes?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid since, got %d", rec.Code)
+	}
+}
+
+func TestHealthServer_EventsStream(t *testing.T) {
+	store := NewRecordStore()
+	store.UpdateSource("docker", 50, 1, []Record{{Name: "a.example.com.", IP: "10.0.0.1", Source: "docker"}})
+	h := NewHealthServer(newTestConfig(""), nil, store)
+
+	srv := httptest.NewServer(http.HandlerFunc(h.handleEvents))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	// readEvent returns the name and data of the next event.
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() (string, string) {
+		var name, data string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				return name, data
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+
+	name, data := readEvent()
+	var snapshot snapshotEvent
+	json.Unmarshal([]byte(data), &snapshot)
+	if name != "snapshot" || len(snapshot.Records) != 1 || snapshot.Records[0].Name != "a.example.com." {
+		t.Fatalf("unexpected first event %s %s", name, data)
+	}
+
+	store.UpdateSource("docker", 50, 2, nil)
+	name, data = readEvent()
+	var ev Event
+	json.Unmarshal([]byte(data), &ev)
+	if name != EventChanges || len(ev.Changes) != 1 || ev.Changes[0].Type != ChangeRemoved {
+		t.Errorf("unexpected change event %s %s", name, data)
+	}
+
+	store.Events().Publish(Event{Type: EventPoll, Source: "docker", Error: "boom", Failures: 1})
+	name, data = readEvent()
+	json.Unmarshal([]byte(data), &ev)
+	if name != EventPoll || ev.Error != "boom" {
+		t.Errorf("unexpected poll event %s %s", name, data)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 )
 
@@ -16,31 +17,139 @@ func main() {
 	if err != nil {
 		log.Fatalf("config: %v", err)
 	}
+	log.SetOutput(newRedactingWriter(os.Stderr, cfg.Secrets()))
 
-	log.Printf("Pangolin API: %s", cfg.PangolinAPIURL)
-	log.Printf("Local IP: %s", cfg.PangolinLocalIP)
+	for _, inst := range cfg.Pangolin {
+		label := "Pangolin API"
+		if inst.Name != "" {
+			label = "Pangolin " + inst.Name
+		}
+		log.Printf("%s: %s (local IP %s, every %s)", label, inst.APIURL, inst.LocalIP, inst.PollInterval)
+	}
 	log.Printf("Upstream DNS: %s", cfg.UpstreamDNS)
-	log.Printf("Poll interval: %s", cfg.PollInterval)
+	for _, rule := range cfg.ForwardRules {
+		log.Printf("Forwarding %s: %s -> %s %s", rule.Name, strings.Join(rule.Domains, ","), strings.Join(rule.Upstreams, ","), rule.Protocol)
+	}
+	if cfg.TargetProbe != "" {
+		log.Printf("Target probes: %s every %s", cfg.TargetProbe, cfg.TargetProbeInterval)
+	}
+	if cfg.UpstreamProbeInterval > 0 {
+		log.Printf("Upstream probes: %s every %s", cfg.UpstreamProbeName, cfg.UpstreamProbeInterval)
+	}
 	log.Printf("Local prefix: %v", cfg.EnableLocalPrefix)
 	log.Printf("Health port: %s", cfg.HealthPort)
+	if cfg.AdminAddr != "" {
+		log.Printf("Admin API: %s", cfg.AdminAddr)
+	}
+	if cfg.TLSCertFile != "" {
+		log.Printf("TLS: %s (client CA %q)", cfg.TLSCertFile, cfg.TLSClientCAFile)
+	}
+	if cfg.TraefikAPIURL != "" {
+		log.Printf("Traefik API: %s (local IP %s)", cfg.TraefikAPIURL, cfg.TraefikLocalIP)
+	}
+	if cfg.DockerSocket != "" {
+		log.Printf("Docker socket: %s, label %s (local IP %s)", cfg.DockerSocket, cfg.DockerLabel, cfg.DockerLocalIP)
+	}
+	for _, inst := range cfg.CaddyInstances {
+		log.Printf("Caddy %s: %s (local IP %s)", inst.Name, inst.APIURL, inst.LocalIP)
+	}
+	for _, inst := range cfg.NPMInstances {
+		log.Printf("Nginx Proxy Manager %s: %s (local IP %s)", inst.Name, inst.APIURL, inst.LocalIP)
+	}
+	if len(cfg.Blocklists) > 0 {
+		log.Printf("Blocklists: %d, refreshed every %s, %s response", len(cfg.Blocklists), cfg.BlocklistRefresh, cfg.BlockResponse)
+	}
+	for _, hook := range cfg.Webhooks {
+		log.Printf("Webhook %s: %s format", hook.Name, hook.Format)
+	}
 
 	store := NewRecordStore()
-	poller := NewPoller(cfg, store)
+	store.SetHistoryLimit(cfg.ChangeHistory)
+	var pollers []*Poller
+	for _, inst := range cfg.Pangolin {
+		pollers = append(pollers, NewPangolinPoller(cfg, inst, store))
+	}
+	if cfg.TraefikAPIURL != "" {
+		src := NewTraefikSource(cfg.TraefikAPIURL, cfg.TraefikLocalIP)
+		pollers = append(pollers, NewSourcePoller(cfg, src, store, cfg.TraefikPollInterval, cfg.TraefikPriority))
+	}
+	if cfg.DockerSocket != "" {
+		src := NewDockerSource(cfg.DockerSocket, cfg.DockerLabel, cfg.DockerLocalIP)
+		pollers = append(pollers, NewSourcePoller(cfg, src, store, cfg.DockerPollInterval, cfg.DockerPriority))
+	}
+	for _, inst := range cfg.CaddyInstances {
+		pollers = append(pollers, NewSourcePoller(cfg, NewCaddySource(inst), store, inst.PollInterval, inst.Priority))
+	}
+	for _, inst := range cfg.NPMInstances {
+		pollers = append(pollers, NewSourcePoller(cfg, NewNPMSource(inst), store, inst.PollInterval, inst.Priority))
+	}
 	dnsServer := NewDNSServer(cfg, store)
-	healthServer := NewHealthServer(cfg, poller, store)
+	healthServer := NewHealthServer(cfg, pollers, store)
+	var prober *UpstreamProber
+	if cfg.UpstreamProbeInterval > 0 {
+		prober = NewUpstreamProber(splitUpstreams(cfg.UpstreamDNS), cfg.UpstreamProbeName, cfg.UpstreamProbeInterval, cfg.UpstreamProbeTimeout)
+		dnsServer.UseProber(prober)
+		healthServer.UseProber(prober)
+	}
+	var targets *TargetProber
+	if cfg.TargetProbe != "" {
+		targets = NewTargetProber(store, cfg.TargetProbe, cfg.TargetProbePorts, cfg.TargetProbeURL, cfg.TargetProbeInterval, cfg.TargetProbeTimeout)
+		dnsServer.UseTargets(targets)
+		healthServer.UseTargets(targets)
+	}
+	var blocker *Blocker
+	if len(cfg.Blocklists) > 0 {
+		blocker = NewBlocker(cfg)
+		dnsServer.UseBlocker(blocker)
+		healthServer.UseBlocker(blocker)
+	}
+	var certs *CertReloader
+	if cfg.TLSCertFile != "" {
+		if certs, err = NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile); err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+		healthServer.UseTLS(certs)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start poller and health server in background
-	go poller.Run(ctx)
+	// Start pollers and health server in background
+	for _, hook := range cfg.Webhooks {
+		go NewWebhookNotifier(hook, store.Events(), cfg.WebhookFailureThreshold, cfg.WebhookRetry).Run(ctx)
+	}
+	for _, p := range pollers {
+		go p.Run(ctx)
+	}
+	if prober != nil {
+		go prober.Run(ctx)
+	}
+	if targets != nil {
+		go targets.Run(ctx)
+	}
+	if blocker != nil {
+		go blocker.Run(ctx)
+	}
 	go healthServer.Run(ctx)
 
-	// Handle shutdown signals
+	// Handle shutdown and reload signals
 	go func() {
 		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-		<-sig
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		for s := range sig {
+			if s != syscall.SIGHUP {
+				break
+			}
+			log.Println("reloading...")
+			if err := cfg.ReloadSecrets(); err != nil {
+				log.Printf("config: reloading secrets failed: %v", err)
+			}
+			if certs != nil {
+				if err := certs.Reload(); err != nil {
+					log.Printf("tls: reload failed, keeping the previous certificates: %v", err)
+				}
+			}
+		}
 		log.Println("shutting down...")
 		cancel()
 	}()
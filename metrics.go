@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metricsWriter writes metrics in the Prometheus text exposition format.
+type metricsWriter struct {
+	w io.Writer
+}
+
+// family starts a metric family with its help text and type.
+func (m metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample. labels are name/value pairs.
+func (m metricsWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=%q", labels[i], labels[i+1])
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(m.w, "%s %g\n", b.String(), value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleMetrics exposes record, source and upstream metrics for Prometheus.
+func (h *HealthServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := metricsWriter{w: w}
+
+	ready := h.readiness(time.Now())
+	m.family("pangolin_dns_ready", "gauge", "Whether the service is ready (1) or not (0).")
+	m.sample("pangolin_dns_ready", boolValue(ready.Status != StatusNotReady))
+	m.family("pangolin_dns_records", "gauge", "Number of DNS records served locally.")
+	m.sample("pangolin_dns_records", float64(h.store.Count()))
+
+	pollers := append([]*Poller(nil), h.pollers...)
+	sort.Slice(pollers, func(i, j int) bool { return pollers[i].src.Name() < pollers[j].src.Name() })
+
+	m.family("pangolin_dns_source_poll_errors_total", "counter", "Failed polls per discovery source.")
+	for _, p := range pollers {
+		m.sample("pangolin_dns_source_poll_errors_total", float64(p.pollErrors.Load()), "source", p.src.Name())
+	}
+	m.family("pangolin_dns_source_poll_duration_seconds", "gauge", "Duration of the last poll per discovery source.")
+	for _, p := range pollers {
+		m.sample("pangolin_dns_source_poll_duration_seconds", time.Duration(p.lastDuration.Load()).Seconds(), "source", p.src.Name())
+	}
+	m.family("pangolin_dns_source_last_success_timestamp_seconds", "gauge", "Unix time of the last successful poll per discovery source.")
+	for _, p := range pollers {
+		if t, ok := p.lastPoll.Load().(time.Time); ok {
+			m.sample("pangolin_dns_source_last_success_timestamp_seconds", float64(t.Unix()), "source", p.src.Name())
+		}
+	}
+
+	if targets := h.targets.Status(); len(targets) > 0 {
+		m.family("pangolin_dns_target_up", "gauge", "Whether a local target IP is reachable (1) or not (0).")
+		for _, t := range targets {
+			m.sample("pangolin_dns_target_up", boolValue(t.State == TargetUp), "ip", t.IP)
+		}
+		m.family("pangolin_dns_target_transitions_total", "counter", "Reachability state changes per local target IP.")
+		for _, t := range targets {
+			m.sample("pangolin_dns_target_transitions_total", float64(t.Transitions), "ip", t.IP)
+		}
+	}
+
+	if bl := h.blocker.Status(); bl != nil {
+		m.family("pangolin_dns_blocklist_domains", "gauge", "Number of distinct blocked domains.")
+		m.sample("pangolin_dns_blocklist_domains", float64(bl.Domains))
+		m.family("pangolin_dns_blocklist_source_domains", "gauge", "Number of domains loaded per blocklist.")
+		for _, src := range bl.Sources {
+			m.sample("pangolin_dns_blocklist_source_domains", float64(src.Domains), "source", src.Source)
+		}
+		groups := make([]string, 0, len(bl.Blocked))
+		for group := range bl.Blocked {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+		m.family("pangolin_dns_blocked_queries_total", "counter", "Queries answered with the block response per client group.")
+		for _, group := range groups {
+			m.sample("pangolin_dns_blocked_queries_total", float64(bl.Blocked[group]), "group", group)
+		}
+	}
+
+	upstreams := h.prober.Status()
+	if len(upstreams) == 0 {
+		return
+	}
+	m.family("pangolin_dns_upstream_healthy", "gauge", "Whether the upstream DNS server passes its probes (1) or not (0).")
+	for _, u := range upstreams {
+		m.sample("pangolin_dns_upstream_healthy", boolValue(u.Healthy), "upstream", u.Address)
+	}
+	m.family("pangolin_dns_upstream_success_ratio", "gauge", "Share of recent successful probes per upstream DNS server.")
+	for _, u := range upstreams {
+		m.sample("pangolin_dns_upstream_success_ratio", u.SuccessRate, "upstream", u.Address)
+	}
+	m.family("pangolin_dns_upstream_latency_seconds", "gauge", "Average latency of recent successful probes per upstream DNS server.")
+	for _, u := range upstreams {
+		m.sample("pangolin_dns_upstream_latency_seconds", u.LatencyMS/1000, "upstream", u.Address)
+	}
+	m.family("pangolin_dns_upstream_probes_total", "counter", "Probes sent per upstream DNS server.")
+	for _, u := range upstreams {
+		m.sample("pangolin_dns_upstream_probes_total", float64(u.Probes), "upstream", u.Address)
+	}
+	m.family("pangolin_dns_upstream_probe_failures_total", "counter", "Failed probes per upstream DNS server.")
+	for _, u := range upstreams {
+		m.sample("pangolin_dns_upstream_probe_failures_total", float64(u.Failures), "upstream", u.Address)
+	}
+}
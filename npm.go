@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NPMSource discovers the domain names of enabled proxy hosts of an Nginx
+// Proxy Manager instance via its REST API and maps them to the instance's
+// local IP. It logs in with the instance's identity and secret and caches
+// the resulting token until it expires.
+type NPMSource struct {
+	inst   ProxyInstance
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// npmProxyHost is the subset of a proxy host returned by
+// /api/nginx/proxy-hosts.
+type npmProxyHost struct {
+	ID          int      `json:"id"`
+	DomainNames []string `json:"domain_names"`
+	Enabled     npmBool  `json:"enabled"`
+	ForwardHost string   `json:"forward_host"`
+	ForwardPort int      `json:"forward_port"`
+}
+
+// npmBool decodes NPM's "enabled" flag, which older versions send as 0/1
+// and newer ones as a boolean.
+type npmBool bool
+
+func (b *npmBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "true" || s == "false" {
+		*b = s == "true"
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid enabled flag %s", data)
+	}
+	*b = n != 0
+	return nil
+}
+
+type npmTokenResponse struct {
+	Token   string `json:"token"`
+	Expires string `json:"expires"`
+}
+
+func NewNPMSource(inst ProxyInstance) *NPMSource {
+	return &NPMSource{
+		inst: inst,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (n *NPMSource) Name() string { return "npm:" + n.inst.Name }
+
+// Fetch returns one record per domain name of every enabled proxy host.
+func (n *NPMSource) Fetch(ctx context.Context) ([]Record, error) {
+	body, err := n.apiGet(ctx, "/api/nginx/proxy-hosts")
+	if err != nil {
+		return nil, fmt.Errorf("GET /api/nginx/proxy-hosts: %w", err)
+	}
+
+	var hosts []npmProxyHost
+	if err := json.Unmarshal(body, &hosts); err != nil {
+		return nil, fmt.Errorf("parse proxy hosts response: %w", err)
+	}
+
+	records := make([]Record, 0)
+	for _, h := range hosts {
+		if !h.Enabled {
+			continue
+		}
+		for _, domain := range h.DomainNames {
+			if domain == "" || strings.Contains(domain, "*") {
+				continue
+			}
+			records = append(records, Record{
+				Name: domain,
+				IP:   n.inst.LocalIP,
+				Meta: map[string]string{"forward": fmt.Sprintf("%s:%d", h.ForwardHost, h.ForwardPort)},
+			})
+		}
+	}
+	return records, nil
+}
+
+// apiGet performs an authenticated GET request. If the cached token is
+// rejected, it logs in again and retries once.
+func (n *NPMSource) apiGet(ctx context.Context, path string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := n.getToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(n.inst.APIURL, "/")+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		body, err := doRequest(n.client, req)
+		var statusErr *httpStatusError
+		if attempt == 0 && errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+			n.resetToken()
+			continue
+		}
+		return body, err
+	}
+}
+
+// getToken returns the cached token, logging in if there is none or it is
+// about to expire.
+func (n *NPMSource) getToken(ctx context.Context) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.token != "" && time.Until(n.expires) > time.Minute {
+		return n.token, nil
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"identity": n.inst.Identity,
+		"secret":   n.inst.Secret.Value(),
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(n.inst.APIURL, "/")+"/api/tokens", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	body, err := doRequest(n.client, req)
+	if err != nil {
+		return "", fmt.Errorf("POST /api/tokens: %w", err)
+	}
+
+	var resp npmTokenResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("parse token response: %w", err)
+	}
+	if resp.Token == "" {
+		return "", fmt.Errorf("POST /api/tokens: empty token")
+	}
+
+	n.token = resp.Token
+	n.expires, err = time.Parse(time.RFC3339, resp.Expires)
+	if err != nil {
+		// Unknown expiry: re-login on the next fetch rather than risk a stale token.
+		n.expires = time.Now()
+	}
+	return n.token, nil
+}
+
+func (n *NPMSource) resetToken() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.token = ""
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newFakeNPM(t *testing.T, logins *int, validToken func() string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/tokens":
+			var creds map[string]string
+			json.NewDecoder(r.Body).Decode(&creds)
+			if creds["identity"] != "admin@example.com" || creds["secret"] != "s3cret" {
+				http.Error(w, `{"error":"invalid credentials"}`, http.StatusUnauthorized)
+				return
+			}
+			*logins++
+			json.NewEncoder(w).Encode(npmTokenResponse{
+				Token:   validToken(),
+				Expires: time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			})
+		case "/api/nginx/proxy-hosts":
+			if r.Header.Get("Authorization") != "Bearer "+validToken() {
+				http.Error(w, `{"error":"token expired"}`, http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`[
+				{"id": 1, "domain_names": ["app.example.com", "app2.example.com"], "enabled": 1, "forward_host": "10.0.0.30", "forward_port": 80},
+				{"id": 2, "domain_names": ["off.example.com"], "enabled": 0},
+				{"id": 3, "domain_names": ["new.example.com"], "enabled": true}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func testNPMInstance(url string) ProxyInstance {
+	return ProxyInstance{
+		Name:     "office",
+		APIURL:   url,
+		LocalIP:  "10.0.0.9",
+		Identity: "admin@example.com",
+		Secret:   NewSecret("s3cret"),
+	}
+}
+
+func TestNPMSource_Fetch(t *testing.T) {
+	logins := 0
+	srv := newFakeNPM(t, &logins, func() string { return "tok1" })
+	defer srv.Close()
+
+	src := NewNPMSource(testNPMInstance(srv.URL))
+	records, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, r := range records {
+		got[r.Name] = r.IP
+	}
+	for _, name := range []string{"app.example.com", "app2.example.com", "new.example.com"} {
+		if got[name] != "10.0.0.9" {
+			t.Errorf("expected %s -> 10.0.0.9, got %q", name, got[name])
+		}
+	}
+	if _, ok := got["off.example.com"]; ok {
+		t.Error("disabled proxy host must not be published")
+	}
+
+	// A second fetch reuses the cached token.
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logins != 1 {
+		t.Errorf("expected 1 login, got %d", logins)
+	}
+}
+
+func TestNPMSource_ReauthenticatesOnUnauthorized(t *testing.T) {
+	logins := 0
+	token := "tok1"
+	srv := newFakeNPM(t, &logins, func() string { return token })
+	defer srv.Close()
+
+	src := NewNPMSource(testNPMInstance(srv.URL))
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token = "tok2" // server-side revocation of the cached token
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatalf("expected re-login after 401, got %v", err)
+	}
+	if logins != 2 {
+		t.Errorf("expected 2 logins, got %d", logins)
+	}
+}
+
+func TestNPMSource_BadCredentials(t *testing.T) {
+	logins := 0
+	srv := newFakeNPM(t, &logins, func() string { return "tok1" })
+	defer srv.Close()
+
+	inst := testNPMInstance(srv.URL)
+	inst.Secret = NewSecret("wrong")
+	if _, err := NewNPMSource(inst).Fetch(context.Background()); err == nil {
+		t.Error("expected error for invalid credentials")
+	}
+}
@@ -0,0 +1,709 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PangolinSource discovers resource domains via the Pangolin Integration API
+// of a single Pangolin instance and maps them to the instance's local IP.
+type PangolinSource struct {
+	inst        PangolinInstance
+	retry       RetryPolicy
+	concurrency int           // max orgs fetched in parallel
+	orgTimeout  time.Duration // per-org fetch timeout; 0 for none
+	client      *http.Client
+
+	mu         sync.Mutex
+	orgStats   []OrgStat                    // per-org outcome of the last fetch
+	orgRecords map[string][]Record          // org ID → records of its last successful fetch
+	orgSkipped map[string][]SkippedResource // org ID → resources skipped in its last successful fetch
+}
+
+// OrgStat describes the outcome of fetching a single org during the last poll.
+type OrgStat struct {
+	OrgID      string `json:"org_id"`
+	DurationMS int64  `json:"duration_ms"`
+	Domains    int    `json:"domains"`
+	Error      string `json:"error,omitempty"`
+}
+
+const (
+	// pangolinPageSize is the number of orgs or resources requested per page.
+	pangolinPageSize = 100
+	// pangolinMaxPages bounds pagination in case the API never returns a
+	// short page.
+	pangolinMaxPages = 1000
+)
+
+// Resource health, derived from the health checks of its targets.
+const (
+	ResourceHealthy   = "healthy"
+	ResourceUnhealthy = "unhealthy"
+	ResourceUnknown   = "unknown"
+)
+
+// Reasons a resource with a domain is not published.
+const (
+	SkipDisabled  = "disabled"
+	SkipUnhealthy = "unhealthy"
+	SkipNoSSL     = "no_ssl"
+)
+
+// SkippedResource is a resource domain that was not published, and why.
+type SkippedResource struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Org    string `json:"org"`
+	Reason string `json:"reason"` // SkipDisabled, SkipUnhealthy or SkipNoSSL
+}
+
+// API response types
+
+type OrgsResponse struct {
+	Data struct {
+		Orgs []struct {
+			OrgID string `json:"orgId"`
+			Name  string `json:"name"`
+		} `json:"orgs"`
+		Pagination struct {
+			Total  int `json:"total"`
+			Limit  int `json:"limit"`
+			Offset int `json:"offset"`
+		} `json:"pagination"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
+
+// PangolinResource is a resource as listed by the Integration API.
+type PangolinResource struct {
+	ResourceID int              `json:"resourceId"`
+	NiceID     string           `json:"niceId"`
+	Name       string           `json:"name"`
+	FullDomain string           `json:"fullDomain"`
+	Enabled    bool             `json:"enabled"`
+	SSL        bool             `json:"ssl"`
+	HTTP       bool             `json:"http"`
+	Protocol   string           `json:"protocol"`  // "tcp" or "udp"
+	ProxyPort  int              `json:"proxyPort"` // raw TCP/UDP resources only
+	SiteID     int              `json:"siteId"`
+	SiteName   string           `json:"siteName"`
+	Targets    []PangolinTarget `json:"targets"` // nil if the API does not report them
+}
+
+// PangolinTarget is a backend a resource proxies to.
+type PangolinTarget struct {
+	TargetID     int    `json:"targetId"`
+	IP           string `json:"ip"`
+	Port         int    `json:"port"`
+	Enabled      bool   `json:"enabled"`
+	HealthStatus string `json:"healthStatus"` // "healthy", "unhealthy", or "unknown" without health checks
+}
+
+// Health returns ResourceHealthy if any enabled target is healthy,
+// ResourceUnhealthy if none is enabled or all enabled targets are unhealthy,
+// and ResourceUnknown otherwise, including when the API does not report
+// targets at all.
+func (r PangolinResource) Health() string {
+	if r.Targets == nil {
+		return ResourceUnknown
+	}
+	health := ResourceUnhealthy
+	for _, t := range r.Targets {
+		if !t.Enabled {
+			continue
+		}
+		switch t.HealthStatus {
+		case ResourceHealthy:
+			return ResourceHealthy
+		case ResourceUnhealthy:
+		default:
+			health = ResourceUnknown
+		}
+	}
+	return health
+}
+
+// TargetIPs returns the distinct addresses of the resource's enabled targets
+// not reported unhealthy, sorted. It returns nil unless there is at least one
+// and all of them are private IPv4 addresses, i.e. reachable from the LAN
+// without going through Pangolin.
+func (r PangolinResource) TargetIPs() []string {
+	var ips []string
+	seen := make(map[string]bool)
+	for _, t := range r.Targets {
+		if !t.Enabled || t.HealthStatus == ResourceUnhealthy {
+			continue
+		}
+		ip := net.ParseIP(t.IP)
+		if ip == nil || ip.To4() == nil || !ip.IsPrivate() {
+			return nil
+		}
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			ips = append(ips, ip.String())
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// Site returns the name of the site the resource is served from, or its ID.
+func (r PangolinResource) Site() string {
+	if r.SiteName != "" || r.SiteID == 0 {
+		return r.SiteName
+	}
+	return strconv.Itoa(r.SiteID)
+}
+
+// TargetsResponse lists the targets of a single resource.
+type TargetsResponse struct {
+	Data struct {
+		Targets []PangolinTarget `json:"targets"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
+
+type ResourcesResponse struct {
+	Data struct {
+		Resources  []PangolinResource `json:"resources"`
+		Pagination struct {
+			Total    int `json:"total"`
+			Page     int `json:"page"`
+			PageSize int `json:"pageSize"`
+		} `json:"pagination"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
+
+func NewPangolinSource(cfg *Config, inst PangolinInstance) *PangolinSource {
+	return &PangolinSource{
+		inst:        inst,
+		retry:       cfg.APIRetry,
+		concurrency: max(cfg.OrgConcurrency, 1),
+		orgTimeout:  cfg.OrgTimeout,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// NewPangolinPoller returns a Poller for a single Pangolin instance.
+func NewPangolinPoller(cfg *Config, inst PangolinInstance, store *RecordStore) *Poller {
+	return NewSourcePoller(cfg, NewPangolinSource(cfg, inst), store, inst.PollInterval, inst.Priority)
+}
+
+func (p *PangolinSource) Name() string {
+	if p.inst.Name == "" {
+		return "pangolin"
+	}
+	return "pangolin:" + p.inst.Name
+}
+
+// Fetch returns one record per enabled resource domain across all orgs. Orgs
+// are fetched in parallel, at most concurrency at a time, each bounded by the
+// per-org timeout. If some orgs fail, the domains of the remaining orgs are
+// returned along with an error.
+func (p *PangolinSource) Fetch(ctx context.Context) ([]Record, error) {
+	orgIDs, err := p.getOrgIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get org IDs: %w", err)
+	}
+
+	type orgResult struct {
+		resources []PangolinResource
+		err       error
+		duration  time.Duration
+	}
+	results := make([]orgResult, len(orgIDs))
+
+	sem := make(chan struct{}, p.concurrency)
+	var wg sync.WaitGroup
+	for i, orgID := range orgIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i].err = ctx.Err()
+				return
+			}
+
+			orgCtx := ctx
+			if p.orgTimeout > 0 {
+				var cancel context.CancelFunc
+				orgCtx, cancel = context.WithTimeout(ctx, p.orgTimeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			resources, err := p.getResourcesForOrg(orgCtx, orgID)
+			results[i] = orgResult{resources: resources, err: err, duration: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	records := make([]Record, 0)
+	stats := make([]OrgStat, len(orgIDs))
+	orgRecords := make(map[string][]Record, len(orgIDs))
+	orgSkipped := make(map[string][]SkippedResource, len(orgIDs))
+	failed := 0
+
+	for i, orgID := range orgIDs {
+		res := results[i]
+		stats[i] = OrgStat{OrgID: orgID, DurationMS: res.duration.Milliseconds()}
+		if res.err != nil {
+			log.Printf("poller: %s: failed to get resources for org %s: %v", p.Name(), orgID, res.err)
+			stats[i].Error = res.err.Error()
+			failed++
+			continue
+		}
+
+		orgRecords[orgID], orgSkipped[orgID] = p.orgRecordsFor(orgID, res.resources)
+		stats[i].Domains = len(orgRecords[orgID])
+		records = append(records, orgRecords[orgID]...)
+	}
+
+	p.mu.Lock()
+	p.orgStats = stats
+	p.orgRecords = orgRecords
+	p.orgSkipped = orgSkipped
+	p.mu.Unlock()
+
+	log.Printf("poller: %s: fetched %d domain(s) from %d org(s)", p.Name(), len(records), len(orgIDs))
+	if failed > 0 {
+		return records, fmt.Errorf("%d of %d org(s) failed", failed, len(orgIDs))
+	}
+	return records, nil
+}
+
+// FetchOrg re-fetches the resources of a single org and returns them along
+// with the records of all other orgs as of the last fetch. An instance
+// configured with an org ID only accepts that org.
+func (p *PangolinSource) FetchOrg(ctx context.Context, orgID string) ([]Record, error) {
+	if p.inst.OrgID != "" && orgID != p.inst.OrgID {
+		return nil, fmt.Errorf("org %s is not served by this instance", orgID)
+	}
+
+	orgCtx := ctx
+	if p.orgTimeout > 0 {
+		var cancel context.CancelFunc
+		orgCtx, cancel = context.WithTimeout(ctx, p.orgTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	resources, err := p.getResourcesForOrg(orgCtx, orgID)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	recs, skipped := p.orgRecordsFor(orgID, resources)
+	stat := OrgStat{OrgID: orgID, DurationMS: time.Since(start).Milliseconds(), Domains: len(recs)}
+	if err != nil {
+		stat.Error = err.Error()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]OrgStat, 0, len(p.orgStats)+1)
+	for _, s := range p.orgStats {
+		if s.OrgID != orgID {
+			stats = append(stats, s)
+		}
+	}
+	p.orgStats = append(stats, stat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resources for org %s: %w", orgID, err)
+	}
+
+	orgRecords := make(map[string][]Record, len(p.orgRecords)+1)
+	for id, recs := range p.orgRecords {
+		orgRecords[id] = recs
+	}
+	orgRecords[orgID] = recs
+	p.orgRecords = orgRecords
+
+	orgSkipped := make(map[string][]SkippedResource, len(p.orgSkipped)+1)
+	for id, s := range p.orgSkipped {
+		orgSkipped[id] = s
+	}
+	orgSkipped[orgID] = skipped
+	p.orgSkipped = orgSkipped
+
+	records := make([]Record, 0)
+	for _, recs := range orgRecords {
+		records = append(records, recs...)
+	}
+	log.Printf("poller: %s: refreshed org %s: %d domain(s)", p.Name(), orgID, len(recs))
+	return records, nil
+}
+
+// orgRecordsFor returns the records of the resources of an org that have a
+// domain, along with those skipped because they are disabled or fail one of
+// the instance's policies. Records carry the resource's state as metadata.
+func (p *PangolinSource) orgRecordsFor(orgID string, resources []PangolinResource) ([]Record, []SkippedResource) {
+	records := make([]Record, 0, len(resources))
+	var skipped []SkippedResource
+	for _, r := range resources {
+		name := r.FullDomain
+		raw := name == "" && !r.HTTP
+		if raw {
+			name = p.rawHost(r)
+		}
+		if name == "" {
+			continue
+		}
+
+		health := r.Health()
+		reason := ""
+		switch {
+		case !r.Enabled:
+			reason = SkipDisabled
+		case p.inst.RequireHealthy && health == ResourceUnhealthy:
+			reason = SkipUnhealthy
+		case p.inst.RequireSSL && !raw && !r.SSL:
+			reason = SkipNoSSL
+		}
+		if reason != "" {
+			skipped = append(skipped, SkippedResource{Name: normalizeName(name), Source: p.Name(), Org: orgID, Reason: reason})
+			continue
+		}
+
+		rec := Record{Name: name, IP: p.inst.LocalIP}
+		meta := map[string]string{
+			"org":    orgID,
+			"health": health,
+		}
+		if !raw {
+			meta["ssl"] = strconv.FormatBool(r.SSL)
+		}
+		if !raw && p.direct(orgID, r) {
+			// Without LAN targets the proxy is the only reachable address.
+			meta["direct"] = "proxy"
+			if ips := r.TargetIPs(); ips != nil {
+				meta["direct"] = "targets"
+				rec.IP = ips[0]
+				if len(ips) > 1 {
+					rec.IPs = ips
+				}
+			}
+		}
+		if r.ResourceID != 0 {
+			meta["resource"] = strconv.Itoa(r.ResourceID)
+		}
+		if r.Protocol != "" {
+			meta["protocol"] = r.Protocol
+		}
+		if site := r.Site(); site != "" {
+			meta["site"] = site
+		}
+		rec.Meta = meta
+		records = append(records, rec)
+
+		if raw {
+			// The host record above points at the proxy; the SRV record
+			// tells clients the proxy port.
+			srvMeta := maps.Clone(meta)
+			srvMeta["port"] = strconv.Itoa(r.ProxyPort)
+			records = append(records, Record{
+				Name: "_" + p.srvService(r) + "._" + r.Protocol + "." + name,
+				SRV:  &SRV{Target: normalizeName(name), Port: uint16(r.ProxyPort)},
+				Meta: srvMeta,
+			})
+		}
+	}
+	return records, skipped
+}
+
+// rawHost returns the host name of a raw TCP/UDP resource,
+// <name>.<SRVDomain>, or "" if it cannot be published: SRV records are
+// disabled, or the resource lacks a usable name, protocol or proxy port.
+func (p *PangolinSource) rawHost(r PangolinResource) string {
+	if p.inst.SRVDomain == "" || r.ProxyPort < 1 || r.ProxyPort > 65535 {
+		return ""
+	}
+	if r.Protocol != "tcp" && r.Protocol != "udp" {
+		return ""
+	}
+	label := dnsLabel(r.Name)
+	if label == "" {
+		label = dnsLabel(r.NiceID)
+	}
+	if label == "" {
+		return ""
+	}
+	return label + "." + p.inst.SRVDomain
+}
+
+// srvService returns the SRV service label of a raw resource: the one
+// configured for its name, or its name itself.
+func (p *PangolinSource) srvService(r PangolinResource) string {
+	label := dnsLabel(r.Name)
+	if label == "" {
+		label = dnsLabel(r.NiceID)
+	}
+	if service, ok := p.inst.SRVServices[label]; ok {
+		return service
+	}
+	return label
+}
+
+// dnsLabel turns a name into a DNS label: lowercase letters, digits and
+// hyphens, with runs of other characters replaced by a single hyphen.
+func dnsLabel(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	label := b.String()
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
+
+// direct reports whether a resource is resolved to its backend targets
+// instead of the instance's local IP, by its org or by its domain matching
+// one of the instance's name patterns.
+func (p *PangolinSource) direct(orgID string, r PangolinResource) bool {
+	if slices.Contains(p.inst.DirectOrgs, orgID) {
+		return true
+	}
+	name := strings.TrimSuffix(strings.ToLower(r.FullDomain), ".")
+	for _, pattern := range p.inst.DirectNames {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// needsTargets reports whether the targets of a resource are needed to publish
+// it: for its health if the instance requires healthy resources, or for
+// direct mode.
+func (p *PangolinSource) needsTargets(orgID string, r PangolinResource) bool {
+	if r.FullDomain == "" {
+		return p.inst.RequireHealthy && !r.HTTP && p.rawHost(r) != ""
+	}
+	return p.inst.RequireHealthy || p.direct(orgID, r)
+}
+
+// OrgStats returns the per-org outcome of the last completed fetch.
+func (p *PangolinSource) OrgStats() []OrgStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.orgStats
+}
+
+// Skipped returns the resource domains not published by the last fetch of
+// each org, sorted by name.
+func (p *PangolinSource) Skipped() []SkippedResource {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var skipped []SkippedResource
+	for _, s := range p.orgSkipped {
+		skipped = append(skipped, s...)
+	}
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Name < skipped[j].Name })
+	return skipped
+}
+
+func (p *PangolinSource) getOrgIDs(ctx context.Context) ([]string, error) {
+	// If org ID is configured, use it directly
+	if p.inst.OrgID != "" {
+		return []string{p.inst.OrgID}, nil
+	}
+
+	// Auto-discover orgs via API (requires root API key)
+	var ids []string
+	pg := newPager(p.Name() + ": /v1/orgs")
+
+	for more := true; more; {
+		path := fmt.Sprintf("/v1/orgs?limit=%d&offset=%d", pangolinPageSize, pg.fetched)
+		body, err := p.apiGet(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %w", path, err)
+		}
+
+		var resp OrgsResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("parse orgs response: %w", err)
+		}
+
+		if !resp.Success {
+			return nil, fmt.Errorf("API returned success=false for /v1/orgs")
+		}
+
+		for _, org := range resp.Data.Orgs {
+			ids = append(ids, org.OrgID)
+			log.Printf("poller: %s: discovered org %q (%s)", p.Name(), org.Name, org.OrgID)
+		}
+
+		more, err = pg.next(len(resp.Data.Orgs), resp.Data.Pagination.Limit, resp.Data.Pagination.Total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no organizations found")
+	}
+
+	return ids, nil
+}
+
+// getResourcesForOrg returns all resources of an org, enabled or not.
+func (p *PangolinSource) getResourcesForOrg(ctx context.Context, orgID string) ([]PangolinResource, error) {
+	var resources []PangolinResource
+	pg := newPager(p.Name() + ": org " + orgID)
+
+	for page, more := 1, true; more; page++ {
+		path := fmt.Sprintf("/v1/org/%s/resources?page=%d&pageSize=%d", orgID, page, pangolinPageSize)
+		body, err := p.apiGet(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %w", path, err)
+		}
+
+		var resp ResourcesResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("parse resources response: %w", err)
+		}
+
+		if !resp.Success {
+			return nil, fmt.Errorf("API returned success=false for %s", path)
+		}
+
+		for _, r := range resp.Data.Resources {
+			// Older Pangolin versions do not list targets along with the
+			// resources; fetch them where they are needed.
+			if r.Enabled && r.Targets == nil && r.ResourceID != 0 && p.needsTargets(orgID, r) {
+				if r.Targets, err = p.getTargets(ctx, r.ResourceID); err != nil {
+					log.Printf("poller: %s: failed to get targets of resource %d, treating its health as unknown: %v", p.Name(), r.ResourceID, err)
+				}
+			}
+			resources = append(resources, r)
+		}
+
+		// Paginate by the resources returned, not by the domains kept:
+		// disabled or domainless resources count too.
+		more, err = pg.next(len(resp.Data.Resources), resp.Data.Pagination.PageSize, resp.Data.Pagination.Total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resources, nil
+}
+
+// getTargets returns the targets of a single resource.
+func (p *PangolinSource) getTargets(ctx context.Context, resourceID int) ([]PangolinTarget, error) {
+	path := fmt.Sprintf("/v1/resource/%d/targets", resourceID)
+	body, err := p.apiGet(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", path, err)
+	}
+
+	var resp TargetsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("parse targets response: %w", err)
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("API returned success=false for %s", path)
+	}
+	return resp.Data.Targets, nil
+}
+
+// pager decides when to stop paginating. Pagination is driven by the items
+// actually returned: a short or empty page always ends it, so a missing or
+// wrong total cannot cause an endless loop. Totals that change between pages
+// or are exceeded by the items returned are logged as inconsistent.
+type pager struct {
+	name       string // for logging
+	fetched    int
+	firstTotal int
+	pages      int
+}
+
+func newPager(name string) *pager {
+	return &pager{name: name, firstTotal: -1}
+}
+
+// next records a page of n items and reports whether another page should be
+// fetched. pageSize is the page size reported by the API (0 if unknown) and
+// total the total number of items it reported.
+func (pg *pager) next(n, pageSize, total int) (bool, error) {
+	pg.pages++
+	pg.fetched += n
+
+	if pg.firstTotal < 0 {
+		pg.firstTotal = total
+	} else if total != pg.firstTotal {
+		log.Printf("poller: %s: inconsistent pagination: total changed from %d to %d", pg.name, pg.firstTotal, total)
+	}
+	if total > 0 && pg.fetched > total {
+		log.Printf("poller: %s: inconsistent pagination: fetched %d items but total is %d", pg.name, pg.fetched, total)
+	}
+
+	if pageSize <= 0 || pageSize > pangolinPageSize {
+		pageSize = pangolinPageSize
+	}
+	if n == 0 || n < pageSize {
+		return false, nil
+	}
+	// Use the API total to avoid fetching an extra empty page when results
+	// are exactly a multiple of the page size.
+	if total > 0 && pg.fetched >= total {
+		return false, nil
+	}
+	if pg.pages >= pangolinMaxPages {
+		return false, fmt.Errorf("%s: gave up after %d pages", pg.name, pangolinMaxPages)
+	}
+	return true, nil
+}
+
+// apiGet performs an authenticated GET request against the Integration API,
+// retrying transient failures according to the source's retry policy.
+func (p *PangolinSource) apiGet(ctx context.Context, path string) ([]byte, error) {
+	url := strings.TrimRight(p.inst.APIURL, "/") + path
+
+	var body []byte
+	err := p.retry.Do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.inst.APIKey.Value())
+
+		body, err = doRequest(p.client, req)
+		return err
+	})
+	return body, err
+}
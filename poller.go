@@ -2,219 +2,244 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-type Poller struct {
-	cfg        *Config
-	store      *RecordStore
-	client     *http.Client
-	lastPoll   atomic.Value // stores time.Time
-	pollErrors atomic.Int64
-}
+// watchRetryDelay is how long to wait before re-establishing a failed watch.
+const watchRetryDelay = 5 * time.Second
 
-// API response types
-
-type OrgsResponse struct {
-	Data struct {
-		Orgs []struct {
-			OrgID string `json:"orgId"`
-			Name  string `json:"name"`
-		} `json:"orgs"`
-	} `json:"data"`
-	Success bool `json:"success"`
+// Poller periodically fetches records from a Source and publishes them to the
+// record store.
+type Poller struct {
+	cfg          *Config
+	src          Source
+	store        *RecordStore
+	interval     time.Duration
+	priority     int
+	lastPoll     atomic.Value // stores time.Time
+	lastDuration atomic.Int64 // duration of the last completed poll, in nanoseconds
+	pollErrors   atomic.Int64
+	failStreak   atomic.Int64  // consecutive failed polls
+	lastError    atomic.Value  // stores the error message of the last failed poll
+	generation   atomic.Uint64 // incremented for every poll started
+
+	mu       sync.Mutex
+	inflight *pollCall // poll currently running, if any
+
+	// fetchMu serializes full polls and org refreshes, so that generations
+	// are assigned in the order results are published.
+	fetchMu sync.Mutex
 }
 
-type ResourcesResponse struct {
-	Data struct {
-		Resources []struct {
-			FullDomain string `json:"fullDomain"`
-			Enabled    bool   `json:"enabled"`
-			Name       string `json:"name"`
-		} `json:"resources"`
-		Pagination struct {
-			Total    int `json:"total"`
-			Page     int `json:"page"`
-			PageSize int `json:"pageSize"`
-		} `json:"pagination"`
-	} `json:"data"`
-	Success bool `json:"success"`
+// pollCall is a poll in flight that concurrent callers can join.
+type pollCall struct {
+	done chan struct{} // closed when the poll has finished
+	err  error
+	next *pollCall // follow-up poll requested by a change during this one, if any
 }
 
-func NewPoller(cfg *Config, store *RecordStore) *Poller {
+// NewSourcePoller returns a Poller that fetches src every interval and
+// publishes its records with the given merge priority.
+func NewSourcePoller(cfg *Config, src Source, store *RecordStore, interval time.Duration, priority int) *Poller {
 	return &Poller{
-		cfg:   cfg,
-		store: store,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		cfg:      cfg,
+		src:      src,
+		store:    store,
+		interval: interval,
+		priority: priority,
 	}
 }
 
-// Run starts the polling loop. It polls immediately on start, then every PollInterval.
+// Run starts the polling loop. It polls immediately on start, then every
+// interval. After a failed poll it retries sooner, starting at the configured
+// retry interval and doubling per consecutive failure until it is back at the
+// normal interval. Sources implementing Watcher are additionally re-polled on
+// every change notification. Cancelling ctx aborts in-flight requests.
 func (p *Poller) Run(ctx context.Context) {
-	p.Poll()
+	p.Poll(ctx)
 
-	ticker := time.NewTicker(p.cfg.PollInterval)
-	defer ticker.Stop()
+	if w, ok := p.src.(Watcher); ok {
+		go p.watch(ctx, w)
+	}
+
+	timer := time.NewTimer(p.interval)
+	defer timer.Stop()
 
 	for {
+		timer.Reset(p.nextDelay(int(p.failStreak.Load())))
+
 		select {
 		case <-ctx.Done():
-			log.Println("poller: shutting down")
+			log.Printf("poller: %s: shutting down", p.src.Name())
 			return
-		case <-ticker.C:
-			p.Poll()
+		case <-timer.C:
+			p.Poll(ctx)
 		}
 	}
 }
 
-// Poll fetches all domains from the Pangolin API and updates the record store.
-// It is safe to call concurrently from the HTTP handler and the polling loop.
-func (p *Poller) Poll() {
-	orgIDs, err := p.getOrgIDs()
-	if err != nil {
-		log.Printf("poller: failed to get org IDs: %v", err)
-		p.pollErrors.Add(1)
-		return
+// nextDelay returns the delay until the next poll after the given number of
+// consecutive failures.
+func (p *Poller) nextDelay(failures int) time.Duration {
+	if failures == 0 || p.cfg.PollRetryInterval <= 0 || p.cfg.PollRetryInterval >= p.interval {
+		return p.interval
 	}
+	return jitter(backoff(p.cfg.PollRetryInterval, p.interval, failures-1))
+}
 
-	records := make(map[string]string)
-	hasError := false
-
-	for _, orgID := range orgIDs {
-		domains, err := p.getDomainsForOrg(orgID)
-		if err != nil {
-			log.Printf("poller: failed to get resources for org %s: %v", orgID, err)
-			hasError = true
-			continue
+// watch runs the source's Watch loop until ctx is cancelled, reconnecting
+// after failures. The source is re-polled after each reconnect to pick up
+// changes missed while disconnected.
+func (p *Poller) watch(ctx context.Context, w Watcher) {
+	changed := func() { p.PollChanged(ctx) }
+	for {
+		err := w.Watch(ctx, changed)
+		if ctx.Err() != nil {
+			return
 		}
+		log.Printf("poller: %s: watch ended: %v; reconnecting in %s", p.src.Name(), err, watchRetryDelay)
 
-		for _, domain := range domains {
-			fqdn := strings.ToLower(domain)
-			if !strings.HasSuffix(fqdn, ".") {
-				fqdn += "."
-			}
-			records[fqdn] = p.cfg.PangolinLocalIP
-
-			if p.cfg.EnableLocalPrefix {
-				localFQDN := "local." + fqdn
-				records[localFQDN] = p.cfg.PangolinLocalIP
-			}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryDelay):
 		}
+		p.PollChanged(ctx)
 	}
-
-	if hasError {
-		p.pollErrors.Add(1)
-	}
-
-	p.store.Update(records)
-	p.lastPoll.Store(time.Now())
-	log.Printf("poller: updated %d DNS records from %d org(s)", len(records), len(orgIDs))
 }
 
-func (p *Poller) getOrgIDs() ([]string, error) {
-	// If org ID is configured, use it directly
-	if p.cfg.PangolinOrgID != "" {
-		return []string{p.cfg.PangolinOrgID}, nil
-	}
-
-	// Auto-discover orgs via API (requires root API key)
-	body, err := p.apiGet("/v1/orgs?limit=1000&offset=0")
-	if err != nil {
-		return nil, fmt.Errorf("GET /v1/orgs: %w", err)
-	}
-
-	var resp OrgsResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return nil, fmt.Errorf("parse orgs response: %w", err)
-	}
-
-	if !resp.Success {
-		return nil, fmt.Errorf("API returned success=false for /v1/orgs")
-	}
-
-	ids := make([]string, 0, len(resp.Data.Orgs))
-	for _, org := range resp.Data.Orgs {
-		ids = append(ids, org.OrgID)
-		log.Printf("poller: discovered org %q (%s)", org.Name, org.OrgID)
-	}
-
-	if len(ids) == 0 {
-		return nil, fmt.Errorf("no organizations found")
-	}
-
-	return ids, nil
+// Poll fetches all records from the source and updates the record store.
+// It is safe to call concurrently from the HTTP handler and the polling loop:
+// concurrent calls are coalesced into a single poll, see PollCoalesced.
+func (p *Poller) Poll(ctx context.Context) error {
+	_, err := p.PollCoalesced(ctx)
+	return err
 }
 
-func (p *Poller) getDomainsForOrg(orgID string) ([]string, error) {
-	var allDomains []string
-	page := 1
-	pageSize := 100
-
-	for {
-		path := fmt.Sprintf("/v1/org/%s/resources?page=%d&pageSize=%d", orgID, page, pageSize)
-		body, err := p.apiGet(path)
-		if err != nil {
-			return nil, fmt.Errorf("GET %s: %w", path, err)
-		}
-
-		var resp ResourcesResponse
-		if err := json.Unmarshal(body, &resp); err != nil {
-			return nil, fmt.Errorf("parse resources response: %w", err)
-		}
+// PollCoalesced polls the source unless a poll is already in flight, in which
+// case it waits for that poll and returns its result. It reports whether this
+// call started a new poll. A caller joining a poll stops waiting when its own
+// ctx is cancelled; the poll itself is governed by the ctx of the caller that
+// started it.
+func (p *Poller) PollCoalesced(ctx context.Context) (started bool, err error) {
+	return p.pollCoalesced(ctx, false)
+}
 
-		if !resp.Success {
-			return nil, fmt.Errorf("API returned success=false for %s", path)
-		}
+// PollChanged polls the source after it reported a change. A poll already in
+// flight may have read the source before the change, so instead of joining
+// it, the caller waits for one more poll that runs as soon as it finishes.
+// Changes reported in the meantime share that follow-up poll.
+func (p *Poller) PollChanged(ctx context.Context) error {
+	_, err := p.pollCoalesced(ctx, true)
+	return err
+}
 
-		for _, r := range resp.Data.Resources {
-			if r.FullDomain != "" && r.Enabled {
-				allDomains = append(allDomains, r.FullDomain)
+func (p *Poller) pollCoalesced(ctx context.Context, changed bool) (started bool, err error) {
+	p.mu.Lock()
+	if c := p.inflight; c != nil {
+		if changed {
+			if c.next == nil {
+				c.next = &pollCall{done: make(chan struct{})}
 			}
+			c = c.next
 		}
+		p.mu.Unlock()
+		select {
+		case <-c.done:
+			return false, c.err
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	c := &pollCall{done: make(chan struct{})}
+	p.inflight = c
+	p.mu.Unlock()
 
-		// Break when all resources have been fetched (use API total to avoid
-		// fetching an extra empty page when results are exactly a multiple of pageSize).
-		if resp.Data.Pagination.Total == 0 || len(allDomains) >= resp.Data.Pagination.Total {
-			break
+	for {
+		c.err = p.poll(ctx, p.src.Fetch)
+
+		p.mu.Lock()
+		next := c.next
+		p.inflight = next
+		p.mu.Unlock()
+		close(c.done)
+		if next == nil {
+			return true, c.err
 		}
-		page++
+		c = next
 	}
+}
 
-	return allDomains, nil
+// RefreshOrg re-fetches a single org of a source implementing OrgFetcher and
+// publishes the source's records. Other sources are polled in full, see
+// PollChanged. A refresh waits for any poll or refresh of the source in
+// progress.
+func (p *Poller) RefreshOrg(ctx context.Context, org string) error {
+	of, ok := p.src.(OrgFetcher)
+	if !ok || org == "" {
+		return p.PollChanged(ctx)
+	}
+	fetch := func(ctx context.Context) ([]Record, error) { return of.FetchOrg(ctx, org) }
+	return p.poll(ctx, fetch)
 }
 
-func (p *Poller) apiGet(path string) ([]byte, error) {
-	url := strings.TrimRight(p.cfg.PangolinAPIURL, "/") + path
+// poll performs a single poll, fetching records with fetch, and publishes an
+// EventPoll with its outcome. Polls of the same source run one at a time, as
+// an org refresh merges the fetched org into the records of the previous poll
+// and must not be overtaken by an older one. It returns the
+// fetch error, if any; records of a partially failed fetch are still
+// published. A poll aborted by cancelling ctx publishes nothing and is not
+// counted as an error.
+func (p *Poller) poll(ctx context.Context, fetch func(context.Context) ([]Record, error)) error {
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+	name := p.src.Name()
+	generation := p.generation.Add(1)
+
+	start := time.Now()
+	records, err := fetch(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	req.Header.Set("Authorization", "Bearer "+p.cfg.PangolinAPIKey)
+	p.lastDuration.Store(int64(time.Since(start)))
 
-	resp, err := p.client.Do(req)
+	ev := Event{Type: EventPoll, Source: name}
 	if err != nil {
-		return nil, err
+		log.Printf("poller: %s: %v", name, err)
+		p.pollErrors.Add(1)
+		ev.Error = err.Error()
+		ev.Failures = p.failStreak.Add(1)
+		p.lastError.Store(ev.Error)
+	} else {
+		p.failStreak.Store(0)
 	}
-	defer resp.Body.Close()
+	defer func() { p.store.Events().Publish(ev) }()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+	if records == nil && err != nil {
+		return err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	published := make([]Record, 0, len(records))
+	for _, r := range records {
+		r.Name = normalizeName(r.Name)
+		r.Source = name
+		published = append(published, r)
+
+		if p.cfg.EnableLocalPrefix {
+			published = append(published, r.withLocalPrefix())
+		}
 	}
 
-	return body, nil
+	if !p.store.UpdateSource(name, p.priority, generation, published) {
+		log.Printf("poller: %s: discarding stale results of poll #%d", name, generation)
+		return err
+	}
+	p.lastPoll.Store(time.Now())
+	ev.Records = len(published)
+	log.Printf("poller: %s: updated %d DNS records", name, len(published))
+	return err
 }
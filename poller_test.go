@@ -1,23 +1,38 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func newTestConfig(apiURL string) *Config {
 	return &Config{
-		PangolinAPIURL:    apiURL,
-		PangolinAPIKey:    "test.key",
+		Pangolin: []PangolinInstance{{
+			APIURL:       apiURL,
+			APIKey:       NewSecret("test.key"),
+			LocalIP:      "10.0.0.1",
+			PollInterval: time.Second,
+		}},
 		PangolinLocalIP:   "10.0.0.1",
 		PollInterval:      time.Second,
 		EnableLocalPrefix: true,
 	}
 }
 
+// newTestPoller returns a Poller for the first Pangolin instance of cfg.
+func newTestPoller(cfg *Config, store *RecordStore) *Poller {
+	return NewPangolinPoller(cfg, cfg.Pangolin[0], store)
+}
+
 func TestPoller_ParsesDomainsFromAPI(t *testing.T) {
 	orgsResp := OrgsResponse{Success: true}
 	orgsResp.Data.Orgs = []struct {
@@ -26,16 +41,12 @@ func TestPoller_ParsesDomainsFromAPI(t *testing.T) {
 	}{{OrgID: "org1", Name: "Test Org"}}
 
 	resourcesResp := ResourcesResponse{Success: true}
-	resourcesResp.Data.Resources = []struct {
-		FullDomain string `json:"fullDomain"`
-		Enabled    bool   `json:"enabled"`
-		Name       string `json:"name"`
-	}{
+	resourcesResp.Data.Resources = []testResource{
 		{FullDomain: "app.example.com", Enabled: true, Name: "App"},
 		{FullDomain: "disabled.example.com", Enabled: false, Name: "Disabled"},
 		{FullDomain: "", Enabled: true, Name: "NoName"},
 	}
-	resourcesResp.Data.Pagination.Total = 1 // only 1 enabled+valid domain
+	resourcesResp.Data.Pagination.Total = 3 // all resources count, enabled or not
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -49,8 +60,8 @@ func TestPoller_ParsesDomainsFromAPI(t *testing.T) {
 	defer srv.Close()
 
 	store := NewRecordStore()
-	poller := NewPoller(newTestConfig(srv.URL), store)
-	poller.Poll()
+	poller := newTestPoller(newTestConfig(srv.URL), store)
+	poller.Poll(context.Background())
 
 	// "app.example.com." should resolve
 	if _, ok := store.Lookup("app.example.com."); !ok {
@@ -78,9 +89,9 @@ func TestPoller_APIError_DoesNotClearStore(t *testing.T) {
 	defer srv.Close()
 
 	cfg := newTestConfig(srv.URL)
-	cfg.PangolinOrgID = "org1" // skip /v1/orgs call
-	poller := NewPoller(cfg, store)
-	poller.Poll()
+	cfg.Pangolin[0].OrgID = "org1" // skip /v1/orgs call
+	poller := newTestPoller(cfg, store)
+	poller.Poll(context.Background())
 
 	// store should be cleared (poll() always calls Update, even on org-level errors)
 	// but error counter should be incremented
@@ -91,11 +102,7 @@ func TestPoller_APIError_DoesNotClearStore(t *testing.T) {
 
 func TestPoller_OrgIDConfig_SkipsOrgDiscovery(t *testing.T) {
 	resourcesResp := ResourcesResponse{Success: true}
-	resourcesResp.Data.Resources = []struct {
-		FullDomain string `json:"fullDomain"`
-		Enabled    bool   `json:"enabled"`
-		Name       string `json:"name"`
-	}{{FullDomain: "svc.internal", Enabled: true, Name: "SVC"}}
+	resourcesResp.Data.Resources = []testResource{{FullDomain: "svc.internal", Enabled: true, Name: "SVC"}}
 	resourcesResp.Data.Pagination.Total = 1
 
 	orgsHit := false
@@ -109,10 +116,10 @@ func TestPoller_OrgIDConfig_SkipsOrgDiscovery(t *testing.T) {
 	defer srv.Close()
 
 	cfg := newTestConfig(srv.URL)
-	cfg.PangolinOrgID = "myorg"
+	cfg.Pangolin[0].OrgID = "myorg"
 	store := NewRecordStore()
-	poller := NewPoller(cfg, store)
-	poller.Poll()
+	poller := newTestPoller(cfg, store)
+	poller.Poll(context.Background())
 
 	if orgsHit {
 		t.Error("should not call /v1/orgs when PANGOLIN_ORG_ID is set")
@@ -125,17 +132,9 @@ func TestPoller_OrgIDConfig_SkipsOrgDiscovery(t *testing.T) {
 func TestPoller_Pagination_UsesTotal(t *testing.T) {
 	// Simulate an org with exactly pageSize (100) resources — pagination must
 	// stop after the first page when Total == len(resources).
-	resources := make([]struct {
-		FullDomain string `json:"fullDomain"`
-		Enabled    bool   `json:"enabled"`
-		Name       string `json:"name"`
-	}, 3)
+	resources := make([]testResource, 3)
 	for i := range resources {
-		resources[i] = struct {
-			FullDomain string `json:"fullDomain"`
-			Enabled    bool   `json:"enabled"`
-			Name       string `json:"name"`
-		}{FullDomain: "host" + string(rune('a'+i)) + ".example.com", Enabled: true}
+		resources[i] = testResource{FullDomain: "host" + string(rune('a'+i)) + ".example.com", Enabled: true}
 	}
 
 	calls := 0
@@ -159,8 +158,8 @@ func TestPoller_Pagination_UsesTotal(t *testing.T) {
 	defer srv.Close()
 
 	store := NewRecordStore()
-	poller := NewPoller(newTestConfig(srv.URL), store)
-	poller.Poll()
+	poller := newTestPoller(newTestConfig(srv.URL), store)
+	poller.Poll(context.Background())
 
 	if calls != 1 {
 		t.Errorf("expected exactly 1 resources API call, got %d", calls)
@@ -187,14 +186,14 @@ func TestPoller_LastPollSet(t *testing.T) {
 	defer srv.Close()
 
 	store := NewRecordStore()
-	poller := NewPoller(newTestConfig(srv.URL), store)
+	poller := newTestPoller(newTestConfig(srv.URL), store)
 
 	if poller.lastPoll.Load() != nil {
 		t.Error("lastPoll should be nil before first poll")
 	}
 
 	before := time.Now()
-	poller.Poll()
+	poller.Poll(context.Background())
 	after := time.Now()
 
 	raw := poller.lastPoll.Load()
@@ -206,3 +205,794 @@ func TestPoller_LastPollSet(t *testing.T) {
 		t.Errorf("lastPoll timestamp %v outside expected range [%v, %v]", ts, before, after)
 	}
 }
+
+// fakeSource is a Source returning canned records and errors.
+type fakeSource struct {
+	name    string
+	records []Record
+	err     error
+}
+
+func (f *fakeSource) Name() string { return f.name }
+
+func (f *fakeSource) Fetch(ctx context.Context) ([]Record, error) {
+	return f.records, f.err
+}
+
+func TestPoller_Source_NormalizesAndPublishes(t *testing.T) {
+	src := &fakeSource{name: "fake", records: []Record{{Name: "App.Example.com", IP: "10.0.0.9"}}}
+	store := NewRecordStore()
+	poller := NewSourcePoller(newTestConfig(""), src, store, time.Second, 0)
+	poller.Poll(context.Background())
+
+	if ip, ok := store.Lookup("app.example.com."); !ok || ip != "10.0.0.9" {
+		t.Errorf("expected app.example.com. -> 10.0.0.9, got %q (found=%v)", ip, ok)
+	}
+	if _, ok := store.Lookup("local.app.example.com."); !ok {
+		t.Error("expected local prefix record for source records")
+	}
+	if recs := store.Records(); len(recs) == 0 || recs[0].Source != "fake" {
+		t.Errorf("expected records tagged with source name, got %+v", recs)
+	}
+}
+
+func TestPoller_Source_ErrorWithoutRecordsKeepsPrevious(t *testing.T) {
+	src := &fakeSource{name: "fake", records: []Record{{Name: "keep.example.com", IP: "10.0.0.9"}}}
+	store := NewRecordStore()
+	poller := NewSourcePoller(newTestConfig(""), src, store, time.Second, 0)
+	poller.Poll(context.Background())
+
+	src.records, src.err = nil, errors.New("boom")
+	poller.Poll(context.Background())
+
+	if _, ok := store.Lookup("keep.example.com."); !ok {
+		t.Error("failed fetch without records must keep previous records")
+	}
+	if poller.pollErrors.Load() != 1 {
+		t.Errorf("expected 1 poll error, got %d", poller.pollErrors.Load())
+	}
+}
+
+func TestPoller_MultipleInstances_PublishIndependently(t *testing.T) {
+	newInstanceServer := func(domain string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resp := ResourcesResponse{Success: true}
+			resp.Data.Resources = []testResource{{FullDomain: domain, Enabled: true}}
+			resp.Data.Pagination.Total = 1
+			json.NewEncoder(w).Encode(resp)
+		}))
+	}
+	home := newInstanceServer("home.example.com")
+	defer home.Close()
+	office := newInstanceServer("office.example.com")
+	defer office.Close()
+
+	cfg := newTestConfig("")
+	cfg.Pangolin = []PangolinInstance{
+		{Name: "home", APIURL: home.URL, APIKey: NewSecret("k"), OrgID: "o", LocalIP: "10.0.0.1"},
+		{Name: "office", APIURL: office.URL, APIKey: NewSecret("k"), OrgID: "o", LocalIP: "10.2.0.1"},
+	}
+	store := NewRecordStore()
+	homePoller := NewPangolinPoller(cfg, cfg.Pangolin[0], store)
+	officePoller := NewPangolinPoller(cfg, cfg.Pangolin[1], store)
+	homePoller.Poll(context.Background())
+	officePoller.Poll(context.Background())
+
+	if ip, _ := store.Lookup("home.example.com."); ip != "10.0.0.1" {
+		t.Errorf("expected home domain -> 10.0.0.1, got %q", ip)
+	}
+	if ip, _ := store.Lookup("office.example.com."); ip != "10.2.0.1" {
+		t.Errorf("expected office domain -> 10.2.0.1, got %q", ip)
+	}
+	if homePoller.src.Name() != "pangolin:home" {
+		t.Errorf("unexpected source name %q", homePoller.src.Name())
+	}
+
+	// A failing office poll must not affect the home instance's records.
+	office.Close()
+	officePoller.Poll(context.Background())
+	if _, ok := store.Lookup("home.example.com."); !ok {
+		t.Error("home records must survive a failing office instance")
+	}
+	if officePoller.pollErrors.Load() != 1 || homePoller.pollErrors.Load() != 0 {
+		t.Errorf("expected error counted for office only, got home=%d office=%d",
+			homePoller.pollErrors.Load(), officePoller.pollErrors.Load())
+	}
+}
+
+// testResource is the element type of ResourcesResponse.Data.Resources.
+type testResource = PangolinResource
+
+// newPagedResourcesServer serves total resources for any org, paginated by
+// the page and pageSize query parameters. Only every tenth resource is
+// enabled. reportedTotal is returned as the pagination total.
+func newPagedResourcesServer(t *testing.T, total, reportedTotal int, calls *int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+
+		resp := ResourcesResponse{Success: true}
+		for i := (page - 1) * pageSize; i < page*pageSize && i < total; i++ {
+			resp.Data.Resources = append(resp.Data.Resources, testResource{
+				FullDomain: fmt.Sprintf("host%d.example.com", i),
+				Enabled:    i%10 == 0,
+			})
+		}
+		resp.Data.Pagination.Total = reportedTotal
+		resp.Data.Pagination.Page = page
+		resp.Data.Pagination.PageSize = pageSize
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestPoller_Pagination_CountsDisabledResources(t *testing.T) {
+	calls := 0
+	srv := newPagedResourcesServer(t, 250, 250, &calls)
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Pangolin[0].OrgID = "org1"
+	cfg.EnableLocalPrefix = false
+	store := NewRecordStore()
+	newTestPoller(cfg, store).Poll(context.Background())
+
+	if calls != 3 {
+		t.Errorf("expected 3 resources API calls, got %d", calls)
+	}
+	if store.Count() != 25 {
+		t.Errorf("expected 25 enabled domains, got %d", store.Count())
+	}
+}
+
+func TestPoller_Pagination_WrongTotalTerminates(t *testing.T) {
+	// The API under-reports the total; pagination must continue until a short
+	// page instead of stopping early or looping.
+	calls := 0
+	srv := newPagedResourcesServer(t, 250, 100, &calls)
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Pangolin[0].OrgID = "org1"
+	cfg.EnableLocalPrefix = false
+	store := NewRecordStore()
+	newTestPoller(cfg, store).Poll(context.Background())
+
+	if calls > 3 {
+		t.Errorf("expected pagination to stop, got %d calls", calls)
+	}
+}
+
+func TestPoller_Pagination_MaxPages(t *testing.T) {
+	// A broken API returning the same full page forever without a total.
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		resp := ResourcesResponse{Success: true}
+		resp.Data.Resources = make([]testResource, pangolinPageSize)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Pangolin[0].OrgID = "org1"
+	poller := newTestPoller(cfg, NewRecordStore())
+	poller.Poll(context.Background())
+
+	if calls != pangolinMaxPages {
+		t.Errorf("expected %d calls before giving up, got %d", pangolinMaxPages, calls)
+	}
+	if poller.pollErrors.Load() == 0 {
+		t.Error("expected poll error after exceeding max pages")
+	}
+}
+
+func TestPoller_OrgDiscovery_Paginates(t *testing.T) {
+	const numOrgs = 150
+	var offsets []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/orgs" {
+			json.NewEncoder(w).Encode(ResourcesResponse{Success: true})
+			return
+		}
+		offsets = append(offsets, r.URL.Query().Get("offset"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		resp := OrgsResponse{Success: true}
+		for i := offset; i < offset+limit && i < numOrgs; i++ {
+			resp.Data.Orgs = append(resp.Data.Orgs, struct {
+				OrgID string `json:"orgId"`
+				Name  string `json:"name"`
+			}{OrgID: fmt.Sprintf("org%d", i)})
+		}
+		resp.Data.Pagination.Total = numOrgs
+		resp.Data.Pagination.Limit = limit
+		resp.Data.Pagination.Offset = offset
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	ids, err := NewPangolinSource(cfg, cfg.Pangolin[0]).getOrgIDs(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != numOrgs {
+		t.Errorf("expected %d orgs, got %d", numOrgs, len(ids))
+	}
+	if strings.Join(offsets, ",") != "0,100" {
+		t.Errorf("expected offsets 0,100, got %v", offsets)
+	}
+}
+
+func TestPangolinSource_RetriesServerErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		resp := ResourcesResponse{Success: true}
+		resp.Data.Resources = []testResource{{FullDomain: "app.example.com", Enabled: true}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Pangolin[0].OrgID = "org1"
+	cfg.APIRetry = RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}
+	store := NewRecordStore()
+	poller := newTestPoller(cfg, store)
+
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("expected poll to succeed after retry, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 API calls, got %d", calls)
+	}
+	if _, ok := store.Lookup("app.example.com."); !ok {
+		t.Error("expected app.example.com. in store")
+	}
+}
+
+func TestPoller_CancelAbortsInFlightPoll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Pangolin[0].OrgID = "org1"
+	poller := newTestPoller(cfg, NewRecordStore())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- poller.Poll(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Poll did not return after cancellation")
+	}
+	if poller.pollErrors.Load() != 0 {
+		t.Error("a cancelled poll must not count as a poll error")
+	}
+	if poller.lastPoll.Load() != nil {
+		t.Error("a cancelled poll must not update lastPoll")
+	}
+}
+
+func TestPoller_NextDelay_BacksOffAfterFailures(t *testing.T) {
+	cfg := newTestConfig("")
+	cfg.PollRetryInterval = time.Second
+	poller := NewSourcePoller(cfg, &fakeSource{name: "fake"}, NewRecordStore(), time.Minute, 0)
+
+	if d := poller.nextDelay(0); d != time.Minute {
+		t.Errorf("expected normal interval without failures, got %s", d)
+	}
+	if d := poller.nextDelay(1); d < 500*time.Millisecond || d >= time.Second {
+		t.Errorf("expected ~1s after first failure, got %s", d)
+	}
+	if d := poller.nextDelay(3); d < 2*time.Second || d >= 4*time.Second {
+		t.Errorf("expected ~4s after third failure, got %s", d)
+	}
+	if d := poller.nextDelay(20); d < 30*time.Second || d > time.Minute {
+		t.Errorf("expected delay capped at the poll interval, got %s", d)
+	}
+}
+
+// newOrgsServer serves numOrgs orgs from /v1/orgs and one resource per org,
+// delegating resource requests to handleOrg.
+func newOrgsServer(t *testing.T, numOrgs int, handleOrg func(w http.ResponseWriter, r *http.Request, orgID string)) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/orgs" {
+			resp := OrgsResponse{Success: true}
+			for i := 0; i < numOrgs; i++ {
+				resp.Data.Orgs = append(resp.Data.Orgs, struct {
+					OrgID string `json:"orgId"`
+					Name  string `json:"name"`
+				}{OrgID: fmt.Sprintf("org%d", i)})
+			}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		orgID := strings.Split(r.URL.Path, "/")[3] // /v1/org/{id}/resources
+		handleOrg(w, r, orgID)
+	}))
+}
+
+func writeOrgResource(w http.ResponseWriter, orgID string) {
+	resp := ResourcesResponse{Success: true}
+	resp.Data.Resources = []testResource{{FullDomain: orgID + ".example.com", Enabled: true}}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestPangolinSource_FetchesOrgsWithBoundedConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := newOrgsServer(t, 10, func(w http.ResponseWriter, r *http.Request, orgID string) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		writeOrgResource(w, orgID)
+	})
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.OrgConcurrency = 3
+	src := NewPangolinSource(cfg, cfg.Pangolin[0])
+	records, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(records) != 10 {
+		t.Errorf("expected 10 records, got %d", len(records))
+	}
+	if m := maxInFlight.Load(); m > 3 || m < 2 {
+		t.Errorf("expected between 2 and 3 orgs in flight, got %d", m)
+	}
+	if stats := src.OrgStats(); len(stats) != 10 || stats[0].OrgID != "org0" || stats[0].Domains != 1 {
+		t.Errorf("unexpected org stats %+v", stats)
+	}
+}
+
+func TestPangolinSource_OrgTimeout(t *testing.T) {
+	srv := newOrgsServer(t, 3, func(w http.ResponseWriter, r *http.Request, orgID string) {
+		if orgID == "org1" {
+			<-r.Context().Done()
+			return
+		}
+		writeOrgResource(w, orgID)
+	})
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.OrgConcurrency = 3
+	cfg.OrgTimeout = 100 * time.Millisecond
+	src := NewPangolinSource(cfg, cfg.Pangolin[0])
+	records, err := src.Fetch(context.Background())
+	if err == nil {
+		t.Fatal("expected error for timed out org")
+	}
+
+	if len(records) != 2 {
+		t.Errorf("expected records of the 2 healthy orgs, got %d", len(records))
+	}
+	stats := src.OrgStats()
+	if len(stats) != 3 || stats[1].Error == "" || stats[0].Error != "" {
+		t.Errorf("expected only org1 to report an error, got %+v", stats)
+	}
+}
+
+// blockingSource is a Source whose Fetch blocks until release is closed.
+type blockingSource struct {
+	fetches atomic.Int32
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingSource() *blockingSource {
+	return &blockingSource{entered: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (b *blockingSource) Name() string { return "blocking" }
+
+func (b *blockingSource) Fetch(ctx context.Context) ([]Record, error) {
+	n := b.fetches.Add(1)
+	b.entered <- struct{}{}
+	<-b.release
+	return []Record{{Name: fmt.Sprintf("gen%d.example.com", n), IP: "10.0.0.1"}}, nil
+}
+
+func TestPoller_ConcurrentPollsAreCoalesced(t *testing.T) {
+	src := newBlockingSource()
+	store := NewRecordStore()
+	poller := NewSourcePoller(newTestConfig(""), src, store, time.Minute, 0)
+
+	type result struct {
+		started bool
+		err     error
+	}
+	results := make(chan result, 2)
+	poll := func() {
+		started, err := poller.PollCoalesced(context.Background())
+		results <- result{started, err}
+	}
+
+	go poll()
+	<-src.entered // first poll is in flight
+	go poll()
+	time.Sleep(50 * time.Millisecond) // let the second caller join
+	close(src.release)
+
+	var started, joined int
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("unexpected error: %v", r.err)
+		}
+		if r.started {
+			started++
+		} else {
+			joined++
+		}
+	}
+
+	if started != 1 || joined != 1 {
+		t.Errorf("expected 1 started and 1 joined poll, got %d started, %d joined", started, joined)
+	}
+	if n := src.fetches.Load(); n != 1 {
+		t.Errorf("expected a single fetch, got %d", n)
+	}
+	if poller.generation.Load() != 1 {
+		t.Errorf("expected generation 1, got %d", poller.generation.Load())
+	}
+}
+
+func TestPoller_ChangeDuringPollTriggersFollowUp(t *testing.T) {
+	src := newBlockingSource()
+	store := NewRecordStore()
+	poller := NewSourcePoller(newTestConfig(""), src, store, time.Minute, 0)
+
+	polled := make(chan error, 1)
+	go func() { polled <- poller.Poll(context.Background()) }()
+	<-src.entered // first poll is in flight, its data may predate the changes
+
+	changed := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { changed <- poller.PollChanged(context.Background()) }()
+	}
+	time.Sleep(50 * time.Millisecond) // let both changes be reported
+	close(src.release)
+
+	for _, ch := range []chan error{polled, changed, changed} {
+		if err := <-ch; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := src.fetches.Load(); n != 2 {
+		t.Errorf("expected one follow-up fetch for both changes, got %d fetches", n)
+	}
+	if _, ok := store.Lookup("gen2.example.com."); !ok {
+		t.Error("expected records of the follow-up poll in store")
+	}
+}
+
+func TestPoller_SequentialPollsIncrementGeneration(t *testing.T) {
+	src := newBlockingSource()
+	close(src.release)
+	store := NewRecordStore()
+	poller := NewSourcePoller(newTestConfig(""), src, store, time.Minute, 0)
+
+	for i := 0; i < 3; i++ {
+		if started, _ := poller.PollCoalesced(context.Background()); !started {
+			t.Fatalf("poll %d should have started a new poll", i+1)
+		}
+	}
+
+	if poller.generation.Load() != 3 {
+		t.Errorf("expected generation 3, got %d", poller.generation.Load())
+	}
+	if _, ok := store.Lookup("gen3.example.com."); !ok {
+		t.Error("expected records of the latest poll in store")
+	}
+}
+
+func TestPangolinResource_Health(t *testing.T) {
+	target := func(enabled bool, status string) PangolinTarget {
+		return PangolinTarget{IP: "10.0.0.5", Port: 80, Enabled: enabled, HealthStatus: status}
+	}
+	cases := []struct {
+		name    string
+		targets []PangolinTarget
+		want    string
+	}{
+		{"not reported", nil, ResourceUnknown},
+		{"no targets", []PangolinTarget{}, ResourceUnhealthy},
+		{"one healthy", []PangolinTarget{target(true, "unhealthy"), target(true, "healthy")}, ResourceHealthy},
+		{"all unhealthy", []PangolinTarget{target(true, "unhealthy"), target(false, "healthy")}, ResourceUnhealthy},
+		{"without health checks", []PangolinTarget{target(true, "unhealthy"), target(true, "unknown")}, ResourceUnknown},
+	}
+	for _, c := range cases {
+		if got := (PangolinResource{Targets: c.targets}).Health(); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestPangolinSource_ResourcePolicies(t *testing.T) {
+	healthy := []PangolinTarget{{IP: "10.0.0.5", Port: 80, Enabled: true, HealthStatus: "healthy"}}
+	unhealthy := []PangolinTarget{{IP: "10.0.0.6", Port: 80, Enabled: true, HealthStatus: "unhealthy"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := ResourcesResponse{Success: true}
+		resp.Data.Resources = []testResource{
+			{ResourceID: 1, FullDomain: "app.example.com", Enabled: true, SSL: true, HTTP: true, Protocol: "tcp", SiteName: "home", Targets: healthy},
+			{ResourceID: 2, FullDomain: "down.example.com", Enabled: true, SSL: true, HTTP: true, Protocol: "tcp", Targets: unhealthy},
+			{ResourceID: 3, FullDomain: "plain.example.com", Enabled: true, HTTP: true, Protocol: "tcp", Targets: healthy},
+			{ResourceID: 4, FullDomain: "off.example.com", Enabled: false, SSL: true, HTTP: true},
+		}
+		resp.Data.Pagination.Total = len(resp.Data.Resources)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.EnableLocalPrefix = false
+	cfg.Pangolin[0].OrgID = "org1"
+	cfg.Pangolin[0].RequireHealthy = true
+	cfg.Pangolin[0].RequireSSL = true
+	store := NewRecordStore()
+	poller := newTestPoller(cfg, store)
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records := store.Records()
+	if len(records) != 1 || records[0].Name != "app.example.com." {
+		t.Fatalf("expected only app.example.com. to be served, got %+v", records)
+	}
+	want := map[string]string{"org": "org1", "health": "healthy", "ssl": "true", "resource": "1", "protocol": "tcp", "site": "home"}
+	for k, v := range want {
+		if records[0].Meta[k] != v {
+			t.Errorf("expected meta %s=%q, got %q", k, v, records[0].Meta[k])
+		}
+	}
+
+	h := NewHealthServer(cfg, []*Poller{poller}, store)
+	rec := httptest.NewRecorder()
+	h.handleDomains(rec, httptest.NewRequest(http.MethodGet, "/domains", nil))
+	var resp struct {
+		Domains []string
+		Records []Record
+		Skipped []SkippedResource
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Records) != 1 || resp.Records[0].Meta["health"] != "healthy" {
+		t.Errorf("expected the record with its metadata, got %+v", resp.Records)
+	}
+	skipped := map[string]string{}
+	for _, s := range resp.Skipped {
+		skipped[s.Name] = s.Reason
+	}
+	wantSkipped := map[string]string{
+		"down.example.com.":  SkipUnhealthy,
+		"plain.example.com.": SkipNoSSL,
+		"off.example.com.":   SkipDisabled,
+	}
+	if len(skipped) != len(wantSkipped) {
+		t.Errorf("expected %d skipped resources, got %+v", len(wantSkipped), resp.Skipped)
+	}
+	for name, reason := range wantSkipped {
+		if skipped[name] != reason {
+			t.Errorf("expected %s skipped as %q, got %q", name, reason, skipped[name])
+		}
+	}
+
+	// Without policies only the disabled resource is skipped.
+	cfg.Pangolin[0].RequireHealthy = false
+	cfg.Pangolin[0].RequireSSL = false
+	poller = newTestPoller(cfg, NewRecordStore())
+	poller.Poll(context.Background())
+	if n := poller.store.Count(); n != 3 {
+		t.Errorf("expected 3 records without policies, got %d", n)
+	}
+}
+
+func TestPangolinSource_DirectTargets(t *testing.T) {
+	var targetCalls atomic.Int32
+	var targetHealth atomic.Value
+	targetHealth.Store("")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/resource/4/targets" {
+			targetCalls.Add(1)
+			resp := TargetsResponse{Success: true}
+			resp.Data.Targets = []PangolinTarget{{IP: "192.168.1.40", Port: 8080, Enabled: true, HealthStatus: targetHealth.Load().(string)}}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		resp := ResourcesResponse{Success: true}
+		resp.Data.Resources = []testResource{
+			{ResourceID: 1, FullDomain: "nas.lan.example.com", Enabled: true, Targets: []PangolinTarget{
+				{IP: "192.168.1.21", Port: 5000, Enabled: true},
+				{IP: "192.168.1.20", Port: 5000, Enabled: true},
+				{IP: "192.168.1.22", Port: 5000, Enabled: false},
+			}},
+			{ResourceID: 2, FullDomain: "remote.lan.example.com", Enabled: true, Targets: []PangolinTarget{
+				{IP: "203.0.113.7", Port: 443, Enabled: true},
+			}},
+			{ResourceID: 3, FullDomain: "app.example.com", Enabled: true, Targets: []PangolinTarget{
+				{IP: "192.168.1.30", Port: 80, Enabled: true},
+			}},
+			{ResourceID: 4, FullDomain: "old.lan.example.com", Enabled: true}, // targets not listed
+		}
+		resp.Data.Pagination.Total = len(resp.Data.Resources)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.EnableLocalPrefix = false
+	cfg.Pangolin[0].OrgID = "org1"
+	cfg.Pangolin[0].DirectNames = []string{"*.lan.example.com"}
+	store := NewRecordStore()
+	if err := newTestPoller(cfg, store).Poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		ips    []string
+		direct string
+	}{
+		{"nas.lan.example.com.", []string{"192.168.1.20", "192.168.1.21"}, "targets"},
+		{"remote.lan.example.com.", []string{"10.0.0.1"}, "proxy"},
+		{"app.example.com.", []string{"10.0.0.1"}, ""},
+		{"old.lan.example.com.", []string{"192.168.1.40"}, "targets"},
+	}
+	records := make(map[string]Record)
+	for _, r := range store.Records() {
+		records[r.Name] = r
+	}
+	for _, c := range cases {
+		r := records[c.name]
+		if got := r.Addrs(); strings.Join(got, ",") != strings.Join(c.ips, ",") {
+			t.Errorf("%s: expected %v, got %v", c.name, c.ips, got)
+		}
+		if r.Meta["direct"] != c.direct {
+			t.Errorf("%s: expected direct=%q, got %q", c.name, c.direct, r.Meta["direct"])
+		}
+	}
+	if n := targetCalls.Load(); n != 1 {
+		t.Errorf("expected targets to be fetched for the one resource without them, got %d calls", n)
+	}
+
+	// Targets are fetched for the health of every resource when healthy
+	// resources are required.
+	cfg.Pangolin[0].DirectNames = nil
+	cfg.Pangolin[0].RequireHealthy = true
+	targetCalls.Store(0)
+	targetHealth.Store(ResourceUnhealthy)
+	store = NewRecordStore()
+	newTestPoller(cfg, store).Poll(context.Background())
+	if n := targetCalls.Load(); n != 1 {
+		t.Errorf("expected targets to be fetched for health, got %d calls", n)
+	}
+	if _, ok := store.Lookup("old.lan.example.com."); ok {
+		t.Error("expected old.lan.example.com. with unhealthy fetched targets to be skipped")
+	}
+	cfg.Pangolin[0].RequireHealthy = false
+
+	// Direct mode by org covers every resource of the org.
+	cfg.Pangolin[0].DirectNames = nil
+	cfg.Pangolin[0].DirectOrgs = []string{"org1"}
+	store = NewRecordStore()
+	newTestPoller(cfg, store).Poll(context.Background())
+	if ip, _ := store.Lookup("app.example.com."); ip != "192.168.1.30" {
+		t.Errorf("expected app.example.com. to resolve to its target, got %s", ip)
+	}
+}
+
+func TestPangolinSource_RawResourcesAsSRV(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := ResourcesResponse{Success: true}
+		resp.Data.Resources = []testResource{
+			{ResourceID: 1, Name: "MC Survival", Enabled: true, Protocol: "tcp", ProxyPort: 25565},
+			{ResourceID: 2, Name: "WireGuard", Enabled: true, Protocol: "udp", ProxyPort: 51820},
+			{ResourceID: 3, Name: "SSH", Enabled: false, Protocol: "tcp", ProxyPort: 2222},
+			{ResourceID: 4, FullDomain: "app.example.com", Enabled: true, HTTP: true, Protocol: "tcp"},
+		}
+		resp.Data.Pagination.Total = len(resp.Data.Resources)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Pangolin[0].OrgID = "org1"
+	cfg.Pangolin[0].RequireSSL = true // does not apply to raw resources
+	cfg.Pangolin[0].SRVDomain = "games.example.com"
+	cfg.Pangolin[0].SRVServices = map[string]string{"mc-survival": "minecraft"}
+	store := NewRecordStore()
+	poller := newTestPoller(cfg, store)
+	poller.Poll(context.Background())
+
+	cases := []struct {
+		name, target string
+		port         uint16
+	}{
+		{"_minecraft._tcp.mc-survival.games.example.com.", "mc-survival.games.example.com.", 25565},
+		{"_minecraft._tcp.local.mc-survival.games.example.com.", "local.mc-survival.games.example.com.", 25565},
+		{"_wireguard._udp.wireguard.games.example.com.", "wireguard.games.example.com.", 51820},
+	}
+	for _, c := range cases {
+		got, ok := store.LookupSRV(c.name)
+		if !ok || got.Target != c.target || got.Port != c.port {
+			t.Errorf("%s: expected %s:%d, got %+v (found %v)", c.name, c.target, c.port, got, ok)
+		}
+		if _, ok := store.Lookup(c.name); ok {
+			t.Errorf("%s: SRV name must not resolve to an address", c.name)
+		}
+		if ip, ok := store.Lookup(c.target); !ok || ip != "10.0.0.1" {
+			t.Errorf("%s: expected the target to resolve to the local IP, got %q", c.target, ip)
+		}
+	}
+	for _, r := range store.Records() {
+		switch r.Name {
+		case "mc-survival.games.example.com.":
+			if _, ok := r.Meta["port"]; ok {
+				t.Errorf("expected no port on the host record, got %v", r.Meta)
+			}
+		case "_minecraft._tcp.mc-survival.games.example.com.":
+			if r.Meta["port"] != "25565" {
+				t.Errorf("expected port 25565 on the SRV record, got %v", r.Meta)
+			}
+		}
+	}
+	if _, ok := store.Lookup("app.example.com."); ok {
+		t.Error("expected the HTTP resource without SSL to be skipped")
+	}
+	skipped := poller.src.(*PangolinSource).Skipped()
+	if len(skipped) != 2 || skipped[1].Name != "ssh.games.example.com." || skipped[1].Reason != SkipDisabled {
+		t.Errorf("expected the disabled raw resource to be skipped, got %+v", skipped)
+	}
+
+	// Without an SRV domain, raw resources are not published.
+	cfg.Pangolin[0].SRVDomain = ""
+	store = NewRecordStore()
+	newTestPoller(cfg, store).Poll(context.Background())
+	if n := store.Count(); n != 0 {
+		t.Errorf("expected no records without an SRV domain, got %v", store.Domains())
+	}
+}
+
+func TestDNSLabel(t *testing.T) {
+	cases := map[string]string{
+		"Minecraft":          "minecraft",
+		"MC Survival (1.20)": "mc-survival-1-20",
+		"--web__server--":    "web-server",
+		"Ümlaut":             "mlaut",
+		"!!!":                "",
+	}
+	for in, want := range cases {
+		if got := dnsLabel(in); got != want {
+			t.Errorf("dnsLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPushBody bounds the size of inbound push requests.
+const maxPushBody = 64 << 10
+
+// pushRequest is the optional JSON body of /push. An empty body refreshes all
+// orgs of all Pangolin instances.
+type pushRequest struct {
+	Instance string `json:"instance,omitempty"` // Pangolin instance name; empty for all
+	Org      string `json:"org,omitempty"`      // org ID; empty for all orgs
+}
+
+type pushResponse struct {
+	Scheduled []string `json:"scheduled"` // sources a refresh was scheduled for
+}
+
+// debouncer runs a function at most once per delay and key: the first
+// trigger schedules it, further triggers until it runs are absorbed.
+type debouncer struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func newDebouncer(delay time.Duration) *debouncer {
+	return &debouncer{delay: delay, pending: make(map[string]bool)}
+}
+
+// trigger schedules fn to run after the delay unless a run for key is already
+// pending. It reports whether a new run was scheduled.
+func (d *debouncer) trigger(key string, fn func()) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending[key] {
+		return false
+	}
+	d.pending[key] = true
+	time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		delete(d.pending, key)
+		d.mu.Unlock()
+		fn()
+	})
+	return true
+}
+
+// handlePush lets Pangolin or another system announce changes. It accepts
+// POST requests authenticated with the configured bearer token or an
+// HMAC-SHA256 signature of the body, and schedules a debounced refresh of the
+// given org, or of all orgs, of the matching Pangolin instances.
+func (h *HealthServer) handlePush(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.PushToken.IsSet() && !h.cfg.PushSecret.IsSet() {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBody))
+	if err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.pushAuthorized(r, body) {
+		log.Printf("health: rejected unauthorized push from %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req pushRequest
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp := pushResponse{Scheduled: []string{}}
+	for _, p := range h.pollers {
+		ps, ok := p.src.(*PangolinSource)
+		if !ok || (req.Instance != "" && req.Instance != ps.inst.Name) {
+			continue
+		}
+		if req.Org != "" && ps.inst.OrgID != "" && req.Org != ps.inst.OrgID {
+			continue
+		}
+
+		p, org := p, req.Org
+		if h.push.trigger(p.src.Name()+"/"+org, func() {
+			if err := p.RefreshOrg(h.ctx, org); err != nil && h.ctx.Err() == nil {
+				log.Printf("health: push refresh of %s failed: %v", p.src.Name(), err)
+			}
+		}) {
+			log.Printf("health: push: refresh of %s scheduled (org %q)", p.src.Name(), org)
+		}
+		resp.Scheduled = append(resp.Scheduled, p.src.Name())
+	}
+	if len(resp.Scheduled) == 0 {
+		http.Error(w, "no matching Pangolin instance", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// pushAuthorized reports whether a push request carries the configured bearer
+// token or a valid signature of body.
+func (h *HealthServer) pushAuthorized(r *http.Request, body []byte) bool {
+	if h.cfg.PushToken.IsSet() {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && secretEqual(token, h.cfg.PushToken.Value()) {
+			return true
+		}
+	}
+	if h.cfg.PushSecret.IsSet() {
+		sig, ok := strings.CutPrefix(r.Header.Get(webhookSignatureHeader), "sha256=")
+		if ok && hmac.Equal([]byte(sig), []byte(signPayload(h.cfg.PushSecret.Value(), body))) {
+			return true
+		}
+	}
+	return false
+}
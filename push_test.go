@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newPushTestServer returns a HealthServer with a single Pangolin poller
+// backed by a fake API serving three orgs, counting resource requests per org.
+func newPushTestServer(t *testing.T, calls map[string]*atomic.Int32) (*HealthServer, *RecordStore) {
+	t.Helper()
+	srv := newOrgsServer(t, 3, func(w http.ResponseWriter, r *http.Request, orgID string) {
+		calls[orgID].Add(1)
+		writeOrgResource(w, orgID)
+	})
+	t.Cleanup(srv.Close)
+
+	cfg := newTestConfig(srv.URL)
+	cfg.PushToken = NewSecret("push-token")
+	cfg.PushSecret = NewSecret("push-secret")
+	cfg.PushDebounce = 50 * time.Millisecond
+	store := NewRecordStore()
+	return NewHealthServer(cfg, []*Poller{newTestPoller(cfg, store)}, store), store
+}
+
+func newOrgCalls() map[string]*atomic.Int32 {
+	return map[string]*atomic.Int32{"org0": {}, "org1": {}, "org2": {}}
+}
+
+func TestPush_RequiresAuthentication(t *testing.T) {
+	h, _ := newPushTestServer(t, newOrgCalls())
+
+	body := `{"org":"org1"}`
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"none", "", "", http.StatusUnauthorized},
+		{"wrong token", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"wrong signature", webhookSignatureHeader, "sha256=" + signPayload("nope", []byte(body)), http.StatusUnauthorized},
+		{"token", "Authorization", "Bearer push-token", http.StatusAccepted},
+		{"signature", webhookSignatureHeader, "sha256=" + signPayload("push-secret", []byte(body)), http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/push", strings.NewReader(body))
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		h.handlePush(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestPush_DisabledWithoutCredentials(t *testing.T) {
+	h := NewHealthServer(newTestConfig(""), nil, NewRecordStore())
+	rec := httptest.NewRecorder()
+	h.handlePush(rec, httptest.NewRequest(http.MethodPost, "/push", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without PUSH_TOKEN or PUSH_SECRET, got %d", rec.Code)
+	}
+}
+
+func TestPush_DebouncesBurstIntoOneOrgRefresh(t *testing.T) {
+	calls := newOrgCalls()
+	h, store := newPushTestServer(t, calls)
+	if err := h.pollers[0].Poll(context.Background()); err != nil {
+		t.Fatalf("initial poll: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/push", strings.NewReader(`{"org":"org1"}`))
+		req.Header.Set("Authorization", "Bearer push-token")
+		h.handlePush(httptest.NewRecorder(), req)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if n := calls["org1"].Load(); n != 2 {
+		t.Errorf("expected org1 to be fetched once more after the burst, got %d fetches in total", n)
+	}
+	if n := calls["org0"].Load(); n != 1 {
+		t.Errorf("expected org0 not to be refreshed, got %d fetches in total", n)
+	}
+	if n := store.Count(); n != 6 { // 3 records plus their local. prefixes
+		t.Errorf("expected the records of all orgs to be kept, got %d", n)
+	}
+}
+
+func TestPangolinSource_FetchOrgKeepsOtherOrgs(t *testing.T) {
+	var suffix atomic.Value // appended to org IDs to change their domains
+	suffix.Store("")
+	srv := newOrgsServer(t, 2, func(w http.ResponseWriter, r *http.Request, orgID string) {
+		writeOrgResource(w, orgID+suffix.Load().(string))
+	})
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	src := NewPangolinSource(cfg, cfg.Pangolin[0])
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	suffix.Store("-new")
+	records, err := src.FetchOrg(context.Background(), "org1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := map[string]bool{}
+	for _, r := range records {
+		names[r.Name] = true
+	}
+	if len(records) != 2 || !names["org0.example.com"] || !names["org1-new.example.com"] {
+		t.Errorf("expected org0 unchanged and org1 refreshed, got %+v", records)
+	}
+}
+
+func TestPangolinSource_FetchOrgRejectsOtherOrg(t *testing.T) {
+	cfg := newTestConfig("http://unused")
+	cfg.Pangolin[0].OrgID = "org0"
+	src := NewPangolinSource(cfg, cfg.Pangolin[0])
+	if _, err := src.FetchOrg(context.Background(), "org1"); err == nil {
+		t.Error("expected error for an org not served by the instance")
+	}
+}
+
+func TestPoller_ConcurrentOrgRefreshesKeepNewestRecords(t *testing.T) {
+	var suffix atomic.Value // appended to org IDs to change their domains
+	suffix.Store("")
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	srv := newOrgsServer(t, 2, func(w http.ResponseWriter, r *http.Request, orgID string) {
+		s := suffix.Load().(string)
+		if orgID == "org0" && s != "" {
+			entered <- struct{}{}
+			<-release // refresh of org0 is slow
+		}
+		writeOrgResource(w, orgID+s)
+	})
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	store := NewRecordStore()
+	poller := newTestPoller(cfg, store)
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("initial poll: %v", err)
+	}
+
+	suffix.Store("-new")
+	done := make(chan error, 2)
+	go func() { done <- poller.RefreshOrg(context.Background(), "org0") }()
+	<-entered
+	go func() { done <- poller.RefreshOrg(context.Background(), "org1") }()
+	time.Sleep(50 * time.Millisecond) // let the refresh of org1 finish first, if it could
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, name := range []string{"org0-new.example.com.", "org1-new.example.com."} {
+		if _, ok := store.Lookup(name); !ok {
+			t.Errorf("expected %s in store, got %v", name, store.Domains())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Overall service states reported by /healthz and /readyz.
+const (
+	StatusOK       = "ok"        // ready, all checks pass
+	StatusDegraded = "degraded"  // ready, but some checks fail
+	StatusNotReady = "not_ready" // no source has completed a successful poll yet
+)
+
+// Check states.
+const (
+	CheckOK      = "ok"
+	CheckPending = "pending" // no successful poll yet, none failed either
+	CheckFailing = "failing" // the last poll failed
+	CheckStale   = "stale"   // the last successful poll is too old
+	CheckDown    = "down"    // an upstream or local target failed its recent probes
+)
+
+// maxPollAgeIntervals is the default maximum age of a source's last
+// successful poll, in poll intervals.
+const maxPollAgeIntervals = 3
+
+// checkResult is the outcome of a single readiness check.
+type checkResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// readiness evaluates one check per source, per probed upstream and per
+// probed local target and
+// derives the overall state: not ready until any source has completed a
+// successful poll, degraded while any check fails.
+func (h *HealthServer) readiness(now time.Time) readinessResponse {
+	resp := readinessResponse{Status: StatusOK, Checks: make([]checkResult, 0, len(h.pollers))}
+
+	ready := len(h.pollers) == 0
+	for _, p := range h.pollers {
+		c := checkResult{Name: "source:" + p.src.Name(), Status: CheckOK}
+		last, polled := p.lastPoll.Load().(time.Time)
+		maxAge := h.cfg.HealthMaxPollAge
+		if maxAge <= 0 {
+			maxAge = maxPollAgeIntervals * p.interval
+		}
+
+		switch failures := p.failStreak.Load(); {
+		case failures > 0:
+			c.Status = CheckFailing
+			c.Message = fmt.Sprintf("%d consecutive failed poll(s)", failures)
+			if err, _ := p.lastError.Load().(string); err != "" {
+				c.Message += ": " + err
+			}
+		case !polled:
+			c.Status = CheckPending
+			c.Message = "waiting for the first poll"
+		case now.Sub(last) > maxAge:
+			c.Status = CheckStale
+			c.Message = fmt.Sprintf("last successful poll %s ago (max %s)", now.Sub(last).Round(time.Second), maxAge)
+		}
+
+		ready = ready || polled
+		if c.Status != CheckOK {
+			resp.Status = StatusDegraded
+		}
+		resp.Checks = append(resp.Checks, c)
+	}
+	for _, u := range h.prober.Status() {
+		c := checkResult{Name: "upstream:" + u.Address, Status: CheckOK}
+		if !u.Healthy {
+			c.Status = CheckDown
+			c.Message = u.LastError
+			resp.Status = StatusDegraded
+		}
+		resp.Checks = append(resp.Checks, c)
+	}
+	for _, t := range h.targets.Status() {
+		c := checkResult{Name: "target:" + t.IP, Status: CheckOK}
+		if t.State == TargetDown {
+			c.Status = CheckDown
+			c.Message = t.LastError
+			resp.Status = StatusDegraded
+		}
+		resp.Checks = append(resp.Checks, c)
+	}
+	if !ready {
+		resp.Status = StatusNotReady
+	}
+	return resp
+}
+
+// statusCode maps an overall state to the HTTP status of /healthz.
+func statusCode(status string) int {
+	if status == StatusOK {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+// handleLive reports that the process is up and serving HTTP. It does not
+// depend on any source, so it only fails if the process is wedged.
+func (h *HealthServer) handleLive(w http.ResponseWriter, r *http.Request) {
+	type liveResponse struct {
+		Status  string `json:"status"`
+		UptimeS int64  `json:"uptime_s"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(liveResponse{Status: StatusOK, UptimeS: int64(time.Since(h.started).Seconds())})
+}
+
+// handleReady reports whether DNS answers can be served from discovered
+// records: 200 when ok or degraded, 503 until the first successful poll.
+func (h *HealthServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	resp := h.readiness(time.Now())
+	code := http.StatusOK
+	if resp.Status == StatusNotReady {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
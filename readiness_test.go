@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// probe requests path from the probe mux of h and decodes the response.
+func probe(t *testing.T, h *HealthServer, path string, v any) int {
+	t.Helper()
+	mux, _ := h.routes()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("%s: decode response: %v", path, err)
+	}
+	return rec.Code
+}
+
+func TestReadiness_States(t *testing.T) {
+	cfg := newTestConfig("")
+	cfg.HealthAnonymous = true
+	src := &fakeSource{name: "fake", err: errors.New("connection refused")}
+	p := NewSourcePoller(cfg, src, NewRecordStore(), time.Minute, 0)
+	h := NewHealthServer(cfg, []*Poller{p}, p.store)
+
+	var ready readinessResponse
+	var health healthResponse
+	var live struct {
+		Status string `json:"status"`
+	}
+
+	// Before the first poll: alive, but not ready.
+	if code := probe(t, h, "/livez", &live); code != http.StatusOK || live.Status != StatusOK {
+		t.Errorf("/livez: expected 200 ok, got %d %q", code, live.Status)
+	}
+	if code := probe(t, h, "/readyz", &ready); code != http.StatusServiceUnavailable || ready.Status != StatusNotReady {
+		t.Errorf("/readyz before first poll: expected 503 not_ready, got %d %q", code, ready.Status)
+	}
+	if len(ready.Checks) != 1 || ready.Checks[0].Name != "source:fake" || ready.Checks[0].Status != CheckPending {
+		t.Errorf("unexpected checks %+v", ready.Checks)
+	}
+
+	// A failed first poll keeps it not ready.
+	p.Poll(context.Background())
+	if code := probe(t, h, "/readyz", &ready); code != http.StatusServiceUnavailable || ready.Checks[0].Status != CheckFailing {
+		t.Errorf("/readyz after failed poll: expected 503 failing, got %d %+v", code, ready)
+	}
+
+	// Ready and healthy after a successful poll.
+	src.err, src.records = nil, []Record{{Name: "a.example.com", IP: "10.0.0.1"}}
+	p.Poll(context.Background())
+	if code := probe(t, h, "/readyz", &ready); code != http.StatusOK || ready.Status != StatusOK {
+		t.Errorf("/readyz after successful poll: expected 200 ok, got %d %q", code, ready.Status)
+	}
+	if code := probe(t, h, "/healthz", &health); code != http.StatusOK || health.Status != StatusOK {
+		t.Errorf("/healthz after successful poll: expected 200 ok, got %d %q", code, health.Status)
+	}
+
+	// Still ready, but degraded, while the source fails.
+	src.err = errors.New("connection refused")
+	p.Poll(context.Background())
+	if code := probe(t, h, "/readyz", &ready); code != http.StatusOK || ready.Status != StatusDegraded {
+		t.Errorf("/readyz while failing: expected 200 degraded, got %d %q", code, ready.Status)
+	}
+	if ready.Checks[0].Message != "1 consecutive failed poll(s): connection refused" {
+		t.Errorf("unexpected check message %q", ready.Checks[0].Message)
+	}
+	if code := probe(t, h, "/healthz", &health); code != http.StatusServiceUnavailable || health.Status != StatusDegraded {
+		t.Errorf("/healthz while failing: expected 503 degraded, got %d %q", code, health.Status)
+	}
+}
+
+func TestReadiness_StaleLastPoll(t *testing.T) {
+	cfg := newTestConfig("")
+	src := &fakeSource{name: "fake", records: []Record{{Name: "a.example.com", IP: "10.0.0.1"}}}
+	p := NewSourcePoller(cfg, src, NewRecordStore(), time.Minute, 0)
+	h := NewHealthServer(cfg, []*Poller{p}, p.store)
+	p.Poll(context.Background())
+
+	if resp := h.readiness(time.Now().Add(2 * time.Minute)); resp.Status != StatusOK {
+		t.Errorf("expected ok within 3 poll intervals, got %+v", resp)
+	}
+	resp := h.readiness(time.Now().Add(4 * time.Minute))
+	if resp.Status != StatusDegraded || resp.Checks[0].Status != CheckStale {
+		t.Errorf("expected stale after 3 poll intervals, got %+v", resp)
+	}
+
+	cfg.HealthMaxPollAge = 10 * time.Minute
+	if resp := h.readiness(time.Now().Add(4 * time.Minute)); resp.Status != StatusOK {
+		t.Errorf("expected ok within HEALTH_MAX_POLL_AGE, got %+v", resp)
+	}
+}
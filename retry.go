@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures retries of transient API request failures with
+// exponential backoff and jitter.
+type RetryPolicy struct {
+	Attempts  int           // total attempts per request; <= 1 disables retries
+	BaseDelay time.Duration // backoff before the first retry, doubled per retry
+	MaxDelay  time.Duration // upper bound for a single backoff
+}
+
+// Do calls fn until it succeeds, returns a non-transient error, the attempts
+// are exhausted or ctx is cancelled. It returns the last error.
+func (rp RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= rp.Attempts || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jitter(backoff(rp.BaseDelay, rp.MaxDelay, attempt-1))):
+		}
+	}
+}
+
+// backoff returns base doubled n times, capped at max (if max > 0).
+func backoff(base, max time.Duration, n int) time.Duration {
+	d := base
+	for i := 0; i < n && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
+
+// jitter returns a random duration in [d/2, d) so that many clients retrying
+// at once spread out.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
+// isTransient reports whether a request error is worth retrying: server
+// errors, rate limiting and timeouts. Cancellation of the caller's context
+// is never transient.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
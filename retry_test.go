@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackoff_DoublesUpToMax(t *testing.T) {
+	cases := []struct {
+		n    int
+		want time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, c := range cases {
+		if got := backoff(time.Second, 10*time.Second, c.n); got != c.want {
+			t.Errorf("backoff(1s, 10s, %d) = %s, want %s", c.n, got, c.want)
+		}
+	}
+}
+
+func TestJitter_StaysWithinRange(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Second); d < 500*time.Millisecond || d >= time.Second {
+			t.Fatalf("jitter(1s) = %s, want [500ms, 1s)", d)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&httpStatusError{StatusCode: 503}, true},
+		{fmt.Errorf("GET /x: %w", &httpStatusError{StatusCode: 500}), true},
+		{&httpStatusError{StatusCode: 429}, true},
+		{&httpStatusError{StatusCode: 401}, false},
+		{&httpStatusError{StatusCode: 404}, false},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{errors.New("parse error"), false},
+	}
+	for _, c := range cases {
+		if got := isTransient(c.err); got != c.want {
+			t.Errorf("isTransient(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicy_RetriesTransientErrors(t *testing.T) {
+	rp := RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond}
+
+	calls := 0
+	err := rp.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return &httpStatusError{StatusCode: 502}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got err=%v calls=%d", err, calls)
+	}
+
+	calls = 0
+	err = rp.Do(context.Background(), func() error {
+		calls++
+		return &httpStatusError{StatusCode: 403}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected no retry for 403, got err=%v calls=%d", err, calls)
+	}
+}
+
+func TestRetryPolicy_StopsOnCancel(t *testing.T) {
+	rp := RetryPolicy{Attempts: 5, BaseDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rp.Do(ctx, func() error { return &httpStatusError{StatusCode: 500} })
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected last error after cancellation")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Do did not return after context cancellation")
+	}
+}
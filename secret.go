@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// redacted replaces secrets in logs and config dumps.
+const redacted = "[redacted]"
+
+// minRedactLen is the shortest secret value redacted from log output; shorter
+// values would mangle unrelated log text.
+const minRedactLen = 4
+
+// Secret is a credential configured either directly via an environment
+// variable or via a file named by its _FILE variant (Docker and Kubernetes
+// secrets). Copies share the value, so reloading a file-based secret updates
+// every holder. Secrets format as "[redacted]" in logs and JSON.
+type Secret struct {
+	file string
+	val  *atomic.Pointer[string]
+}
+
+// NewSecret returns a Secret with a fixed value.
+func NewSecret(v string) Secret {
+	s := Secret{val: new(atomic.Pointer[string])}
+	s.val.Store(&v)
+	return s
+}
+
+// Value returns the secret in clear text.
+func (s Secret) Value() string {
+	if s.val == nil {
+		return ""
+	}
+	if v := s.val.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+// IsSet reports whether the secret has a value.
+func (s Secret) IsSet() bool {
+	return s.Value() != ""
+}
+
+// Reload re-reads a file-based secret. On error the previous value is kept.
+func (s Secret) Reload() error {
+	if s.file == "" {
+		return nil
+	}
+	v, err := readSecretFile(s.file)
+	if err != nil {
+		return err
+	}
+	s.val.Store(&v)
+	return nil
+}
+
+func (s Secret) String() string {
+	if !s.IsSet() {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("Secret(%q)", s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// envSecret reads the secret key from the environment, or from the file
+// named by key_FILE. Setting both is an error.
+func envSecret(key string) (Secret, error) {
+	v, file := os.Getenv(key), os.Getenv(key+"_FILE")
+	switch {
+	case v != "" && file != "":
+		return Secret{}, fmt.Errorf("only one of %s and %s_FILE may be set", key, key)
+	case file != "":
+		v, err := readSecretFile(file)
+		if err != nil {
+			return Secret{}, fmt.Errorf("%s_FILE: %w", key, err)
+		}
+		s := NewSecret(v)
+		s.file = file
+		return s, nil
+	}
+	return NewSecret(v), nil
+}
+
+// readSecretFile returns the contents of a secret file without surrounding
+// whitespace such as the trailing newline most editors add.
+func readSecretFile(name string) (string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// redactingWriter replaces the current values of secrets in everything
+// written through it, as a last line of defence against secrets ending up in
+// logs via error messages or response bodies.
+type redactingWriter struct {
+	w       io.Writer
+	secrets []Secret
+}
+
+func newRedactingWriter(w io.Writer, secrets []Secret) io.Writer {
+	return &redactingWriter{w: w, secrets: secrets}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	out := p
+	for _, s := range r.secrets {
+		if v := s.Value(); len(v) >= minRedactLen && bytes.Contains(out, []byte(v)) {
+			out = bytes.ReplaceAll(out, []byte(v), []byte(redacted))
+		}
+	}
+	if _, err := r.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
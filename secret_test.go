@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvSecret_FromFileAndReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "api_key")
+	os.WriteFile(file, []byte("first.key\n"), 0o600)
+	t.Setenv("PANGOLIN_API_KEY", "")
+	t.Setenv("PANGOLIN_API_KEY_FILE", file)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key := cfg.Pangolin[0].APIKey
+	if key.Value() != "first.key" {
+		t.Fatalf("expected key from file without trailing newline, got %q", key.Value())
+	}
+
+	os.WriteFile(file, []byte("second.key\n"), 0o600)
+	if err := cfg.ReloadSecrets(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if key.Value() != "second.key" {
+		t.Errorf("expected copies of the secret to see the reloaded key, got %q", key.Value())
+	}
+
+	os.Remove(file)
+	if err := cfg.ReloadSecrets(); err == nil {
+		t.Error("expected error for a missing secret file")
+	}
+	if key.Value() != "second.key" {
+		t.Errorf("expected the previous key to be kept, got %q", key.Value())
+	}
+}
+
+func TestEnvSecret_RejectsValueAndFile(t *testing.T) {
+	t.Setenv("PANGOLIN_API_KEY", "test.key")
+	t.Setenv("ADMIN_TOKEN", "token")
+	t.Setenv("ADMIN_TOKEN_FILE", "/run/secrets/admin_token")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected error when both ADMIN_TOKEN and ADMIN_TOKEN_FILE are set")
+	}
+}
+
+func TestSecret_Redacted(t *testing.T) {
+	inst := PangolinInstance{Name: "home", APIKey: NewSecret("super.secret")}
+	for _, s := range []string{fmt.Sprint(inst), fmt.Sprintf("%+v", inst), fmt.Sprintf("%#v", inst)} {
+		if strings.Contains(s, "super.secret") {
+			t.Errorf("secret leaked in %q", s)
+		}
+	}
+	b, _ := json.Marshal(inst)
+	if strings.Contains(string(b), "super.secret") || !strings.Contains(string(b), redacted) {
+		t.Errorf("expected redacted JSON, got %s", b)
+	}
+	if NewSecret("").String() != "" {
+		t.Error("expected an unset secret to format as empty")
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	key := NewSecret("super.secret")
+	w := newRedactingWriter(&buf, []Secret{key, NewSecret("ab")})
+
+	msg := "GET /v1/orgs?key=super.secret failed: ab\n"
+	n, err := w.Write([]byte(msg))
+	if err != nil || n != len(msg) {
+		t.Fatalf("unexpected write result %d, %v", n, err)
+	}
+	if got := buf.String(); got != "GET /v1/orgs?key=[redacted] failed: ab\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestHealthServer_ConfigRedactsSecrets(t *testing.T) {
+	cfg := newTestConfig("")
+	cfg.AdminToken = NewSecret("admin-token")
+	h := NewHealthServer(cfg, nil, NewRecordStore())
+	_, admin := h.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/config", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "test.key") || strings.Contains(body, "admin-token") || !strings.Contains(body, redacted) {
+		t.Errorf("expected secrets to be redacted, got %s", body)
+	}
+}
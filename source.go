@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Record is a single DNS name discovered by a Source.
+type Record struct {
+	Name   string            `json:"name"`           // FQDN (with trailing dot)
+	IP     string            `json:"ip"`             // address the name resolves to
+	IPs    []string          `json:"ips,omitempty"`  // all addresses if there are several; IP is the first
+	SRV    *SRV              `json:"srv,omitempty"`  // set instead of IP for SRV records
+	Source string            `json:"source"`         // name of the source that published it
+	Meta   map[string]string `json:"meta,omitempty"` // source-specific target metadata
+}
+
+// SRV is the service location an SRV record points to.
+type SRV struct {
+	Target string `json:"target"` // FQDN (with trailing dot) of the host
+	Port   uint16 `json:"port"`
+}
+
+// Addrs returns all addresses the record resolves to, none for SRV records.
+func (r Record) Addrs() []string {
+	switch {
+	case r.SRV != nil:
+		return nil
+	case len(r.IPs) > 0:
+		return r.IPs
+	}
+	return []string{r.IP}
+}
+
+// rdata returns the record's data as shown in changes: its addresses,
+// comma-separated, or the target and port of an SRV record.
+func (r Record) rdata() string {
+	if r.SRV != nil {
+		return fmt.Sprintf("%s:%d", r.SRV.Target, r.SRV.Port)
+	}
+	return strings.Join(r.Addrs(), ",")
+}
+
+// withLocalPrefix returns the record under its "local." name. For SRV
+// records the prefix goes after the service and protocol labels, and the
+// target is prefixed as well.
+func (r Record) withLocalPrefix() Record {
+	if r.SRV == nil {
+		r.Name = "local." + r.Name
+		return r
+	}
+	labels := strings.SplitN(r.Name, ".", 3)
+	if len(labels) == 3 {
+		r.Name = labels[0] + "." + labels[1] + ".local." + labels[2]
+	}
+	r.SRV = &SRV{Target: "local." + r.SRV.Target, Port: r.SRV.Port}
+	return r
+}
+
+// Source discovers DNS names from an external system such as Pangolin.
+// Sources are driven by a Poller, which normalizes the returned names and
+// publishes them to the RecordStore under the source's name.
+type Source interface {
+	// Name identifies the source in logs, metrics and the record store.
+	// It must be unique among all configured sources.
+	Name() string
+
+	// Fetch returns the source's current records. A source that fails only
+	// partially may return the records it did collect together with a
+	// non-nil error; those are still published. Returning a nil slice with an
+	// error keeps the records from the previous successful fetch.
+	Fetch(ctx context.Context) ([]Record, error)
+}
+
+// Watcher is implemented by sources that can notify about changes as they
+// happen. The Poller calls Watch alongside its regular polling loop and
+// re-polls the source whenever changed is called.
+type Watcher interface {
+	// Watch blocks until ctx is cancelled or the watch fails, calling
+	// changed whenever the source's records may have changed.
+	Watch(ctx context.Context, changed func()) error
+}
+
+// OrgFetcher is implemented by sources grouping their records by
+// organization, allowing a single org to be refreshed without re-fetching the
+// others.
+type OrgFetcher interface {
+	// FetchOrg re-fetches the records of org and returns all of the source's
+	// records, with those of other orgs as of their last fetch.
+	FetchOrg(ctx context.Context, org string) ([]Record, error)
+}
+
+// normalizeName lowercases a hostname and makes it fully qualified.
+func normalizeName(name string) string {
+	fqdn := strings.ToLower(strings.TrimSpace(name))
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	return fqdn
+}
+
+// doRequest performs req and returns the response body, treating any
+// non-200 status as an error.
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return body, nil
+}
+
+// httpStatusError is returned by doRequest for non-200 responses.
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
+}
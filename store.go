@@ -1,35 +1,178 @@
 package main
 
 import (
+	"log"
+	"sort"
 	"sync"
+	"time"
 )
 
 // RecordStore holds DNS records in memory with thread-safe access.
-// Records are swapped atomically on each poll cycle.
+// Each source's records are kept separately and merged into a single view
+// whenever one of them changes; the merged view is swapped atomically.
 type RecordStore struct {
 	mu      sync.RWMutex
-	records map[string]string // FQDN (with trailing dot) → IP
+	sources map[string]sourceRecords // source name → its latest records
+	records map[string]Record        // FQDN (with trailing dot) → winning record
+	history changeHistory            // recent changes of the merged view
+	events  *EventBus                // receives an EventChanges per effective update
+}
+
+type sourceRecords struct {
+	priority   int
+	generation uint64
+	records    []Record
 }
 
 func NewRecordStore() *RecordStore {
 	return &RecordStore{
-		records: make(map[string]string),
+		sources: make(map[string]sourceRecords),
+		records: make(map[string]Record),
+		history: changeHistory{limit: defaultChangeHistory},
+		events:  NewEventBus(),
 	}
 }
 
-// Update replaces all records atomically.
+// Events returns the bus on which the store publishes record changes and
+// pollers publish their poll results.
+func (s *RecordStore) Events() *EventBus {
+	return s.events
+}
+
+// SetHistoryLimit sets how many changes are kept in the change history.
+func (s *RecordStore) SetHistoryLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history.limit = n
+	s.history.add(nil)
+}
+
+// Update replaces all records atomically, discarding the contributions of
+// every source.
 func (s *RecordStore) Update(records map[string]string) {
+	recs := make([]Record, 0, len(records))
+	for name, ip := range records {
+		recs = append(recs, Record{Name: name, IP: ip})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources = map[string]sourceRecords{"": {records: recs}}
+	s.merge("", false)
+}
+
+// UpdateSource replaces the records published by a single source and
+// re-merges the store. When several sources publish the same name, the
+// source with the highest priority wins; ties go to the source whose name
+// sorts first.
+//
+// generation must increase with every poll of the source; results older
+// than the ones already stored are discarded so a slow poll can never
+// overwrite a newer one. It reports whether the records were applied.
+func (s *RecordStore) UpdateSource(source string, priority int, generation uint64, records []Record) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.records = records
+	cur, ok := s.sources[source]
+	if ok && generation <= cur.generation {
+		return false
+	}
+	s.sources[source] = sourceRecords{priority: priority, generation: generation, records: records}
+	s.merge(source, !ok)
+	return true
+}
+
+// merge rebuilds the merged view from all sources after source was updated,
+// logs the differences to the previous view, records them in the change
+// history and publishes them as an EventChanges, marked initial if these are
+// the first records of the source. Callers must hold s.mu.
+func (s *RecordStore) merge(source string, initial bool) {
+	names := make([]string, 0, len(s.sources))
+	for name := range s.sources {
+		names = append(names, name)
+	}
+	// Apply lowest priority first so higher priorities overwrite.
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := s.sources[names[i]].priority, s.sources[names[j]].priority
+		if pi != pj {
+			return pi < pj
+		}
+		return names[i] > names[j]
+	})
+
+	merged := make(map[string]Record)
+	for _, name := range names {
+		for _, r := range s.sources[name].records {
+			merged[r.Name] = r
+		}
+	}
+
+	changes := diffRecords(s.records, merged, time.Now())
+	for _, c := range changes {
+		switch c.Type {
+		case ChangeAdded:
+			log.Printf("store: + %s -> %s (%s)", c.Name, c.IP, c.Source)
+		case ChangeRemoved:
+			log.Printf("store: - %s -> %s (%s)", c.Name, c.IP, c.Source)
+		case ChangeChanged:
+			log.Printf("store: ~ %s -> %s (%s), was %s (%s)", c.Name, c.IP, c.Source, c.OldIP, c.OldSource)
+		}
+	}
+	s.history.add(changes)
+	s.records = merged
+
+	if len(changes) > 0 {
+		s.events.Publish(Event{Type: EventChanges, Source: source, Changes: changes, Initial: initial})
+	}
+}
+
+// Changes returns the recorded changes newer than since, oldest first.
+func (s *RecordStore) Changes(since time.Time) []Change {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.history.since(since)
 }
 
 // Lookup returns the IP for a given FQDN (with trailing dot).
 func (s *RecordStore) Lookup(fqdn string) (string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	ip, ok := s.records[fqdn]
-	return ip, ok
+	r, ok := s.records[fqdn]
+	if !ok || r.SRV != nil {
+		return "", false
+	}
+	return r.IP, true
+}
+
+// LookupAll returns all IPs for a given FQDN (with trailing dot).
+func (s *RecordStore) LookupAll(fqdn string) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.records[fqdn]
+	if !ok || r.SRV != nil {
+		return nil, false
+	}
+	return r.Addrs(), true
+}
+
+// Has reports whether the store holds a record of any type for a given FQDN
+// (with trailing dot).
+func (s *RecordStore) Has(fqdn string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.records[fqdn]
+	return ok
+}
+
+// LookupSRV returns the service location for a given SRV name (with
+// trailing dot).
+func (s *RecordStore) LookupSRV(fqdn string) (SRV, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.records[fqdn]
+	if !ok || r.SRV == nil {
+		return SRV{}, false
+	}
+	return *r.SRV, true
 }
 
 // Count returns the number of records.
@@ -49,3 +192,15 @@ func (s *RecordStore) Domains() []string {
 	}
 	return domains
 }
+
+// Records returns a copy of the merged records, sorted by name.
+func (s *RecordStore) Records() []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records
+}
@@ -74,3 +74,60 @@ func TestRecordStore_ConcurrentAccess(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestRecordStore_UpdateSource_PriorityWins(t *testing.T) {
+	s := NewRecordStore()
+	s.UpdateSource("low", 10, 1, []Record{
+		{Name: "app.example.com.", IP: "1.1.1.1"},
+		{Name: "only-low.example.com.", IP: "3.3.3.3"},
+	})
+	s.UpdateSource("high", 20, 1, []Record{{Name: "app.example.com.", IP: "2.2.2.2"}})
+
+	if ip, _ := s.Lookup("app.example.com."); ip != "2.2.2.2" {
+		t.Errorf("expected higher priority source to win, got %q", ip)
+	}
+	if _, ok := s.Lookup("only-low.example.com."); !ok {
+		t.Error("names unique to the lower priority source should be kept")
+	}
+}
+
+func TestRecordStore_UpdateSource_ReplacesOnlyThatSource(t *testing.T) {
+	s := NewRecordStore()
+	s.UpdateSource("a", 0, 1, []Record{{Name: "a.example.com.", IP: "1.1.1.1"}})
+	s.UpdateSource("b", 0, 1, []Record{{Name: "b.example.com.", IP: "2.2.2.2"}})
+	s.UpdateSource("a", 0, 2, nil)
+
+	if _, ok := s.Lookup("a.example.com."); ok {
+		t.Error("record of source a should have been removed")
+	}
+	if _, ok := s.Lookup("b.example.com."); !ok {
+		t.Error("record of source b should be untouched")
+	}
+}
+
+func TestRecordStore_UpdateSource_TieBreaksByName(t *testing.T) {
+	s := NewRecordStore()
+	s.UpdateSource("zeta", 5, 1, []Record{{Name: "x.example.com.", IP: "2.2.2.2"}})
+	s.UpdateSource("alpha", 5, 1, []Record{{Name: "x.example.com.", IP: "1.1.1.1"}})
+
+	if ip, _ := s.Lookup("x.example.com."); ip != "1.1.1.1" {
+		t.Errorf("expected tie to go to source sorting first, got %q", ip)
+	}
+}
+
+func TestRecordStore_UpdateSource_DiscardsStaleGeneration(t *testing.T) {
+	s := NewRecordStore()
+	if !s.UpdateSource("src", 0, 2, []Record{{Name: "new.example.com.", IP: "2.2.2.2"}}) {
+		t.Fatal("expected first update to be applied")
+	}
+	if s.UpdateSource("src", 0, 1, []Record{{Name: "old.example.com.", IP: "1.1.1.1"}}) {
+		t.Error("expected older generation to be rejected")
+	}
+
+	if _, ok := s.Lookup("old.example.com."); ok {
+		t.Error("stale results must not overwrite newer ones")
+	}
+	if _, ok := s.Lookup("new.example.com."); !ok {
+		t.Error("newer results must be kept")
+	}
+}
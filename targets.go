@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Local target probe modes.
+const (
+	TargetProbeTCP  = "tcp"
+	TargetProbeHTTP = "http"
+)
+
+// targetUnhealthyAfter is the number of consecutive failed probes after which
+// a local IP is considered down.
+const targetUnhealthyAfter = 2
+
+// Target states reported in events and /healthz.
+const (
+	TargetUp   = "up"
+	TargetDown = "down"
+)
+
+// TargetProber periodically checks that the local IPs records resolve to are
+// reachable, either by connecting to one of a set of TCP ports or by an HTTP
+// request. Names mapped to a local IP that is down are forwarded upstream
+// instead of being answered locally, so clients fall back to the public
+// route. State transitions are logged and published as EventTarget.
+type TargetProber struct {
+	store    *RecordStore
+	mode     string
+	ports    []int  // tcp: healthy if any port accepts a connection
+	url      string // http: URL template, "{ip}" is replaced by the IP
+	interval time.Duration
+	timeout  time.Duration
+	client   *http.Client
+
+	mu      sync.Mutex
+	targets map[string]*targetState // local IP → state
+}
+
+type targetState struct {
+	streak      int // consecutive failed probes
+	since       time.Time
+	transitions int64
+	lastError   string
+}
+
+func (s *targetState) up() bool { return s.streak < targetUnhealthyAfter }
+
+// TargetStatus reports the reachability of one local IP.
+type TargetStatus struct {
+	IP          string `json:"ip"`
+	State       string `json:"state"` // TargetUp or TargetDown
+	Since       string `json:"since"` // time of the last transition, or of the first probe
+	Transitions int64  `json:"transitions"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+func NewTargetProber(store *RecordStore, mode string, ports []int, url string, interval, timeout time.Duration) *TargetProber {
+	return &TargetProber{
+		store:    store,
+		mode:     mode,
+		ports:    ports,
+		url:      url,
+		interval: interval,
+		timeout:  timeout,
+		client: &http.Client{
+			Timeout: timeout,
+			// Any response proves the target is reachable; don't follow
+			// redirects to hosts that may not be.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		targets: make(map[string]*targetState),
+	}
+}
+
+// Run probes all local IPs immediately, then every interval until ctx is
+// cancelled.
+func (t *TargetProber) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		t.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes every distinct IP currently served, in parallel, and
+// forgets IPs no longer served. Backend targets of direct-mode resources are
+// not probed: they listen on their own ports rather than the probe's, and
+// Pangolin's health checks already leave out unhealthy ones.
+func (t *TargetProber) ProbeAll(ctx context.Context) {
+	ips := make(map[string]bool)
+	for _, r := range t.store.Records() {
+		if r.Meta["direct"] == "targets" {
+			continue
+		}
+		for _, ip := range r.Addrs() {
+			ips[ip] = true
+		}
+	}
+
+	t.mu.Lock()
+	for ip := range t.targets {
+		if !ips[ip] {
+			delete(t.targets, ip)
+		}
+	}
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for ip := range ips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := t.probe(ctx, ip)
+			if ctx.Err() != nil {
+				return
+			}
+			t.record(ip, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// probe checks a single IP.
+func (t *TargetProber) probe(ctx context.Context, ip string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	if t.mode == TargetProbeHTTP {
+		host := ip
+		if strings.Contains(ip, ":") {
+			host = "[" + ip + "]"
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", strings.ReplaceAll(t.url, "{ip}", host), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	var dialer net.Dialer
+	var errs []string
+	for _, port := range t.ports {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return fmt.Errorf("no port reachable: %s", strings.Join(errs, "; "))
+}
+
+// record adds a probe result, logging and publishing state transitions.
+func (t *TargetProber) record(ip string, err error) {
+	t.mu.Lock()
+	s, ok := t.targets[ip]
+	if !ok {
+		s = &targetState{since: time.Now()}
+		t.targets[ip] = s
+	}
+	wasUp := s.up()
+	if err != nil {
+		s.streak++
+		s.lastError = err.Error()
+	} else {
+		s.streak = 0
+		s.lastError = ""
+	}
+	up := s.up()
+	if up != wasUp {
+		s.since = time.Now()
+		s.transitions++
+	}
+	t.mu.Unlock()
+
+	if up == wasUp {
+		return
+	}
+	ev := Event{Type: EventTarget, Target: ip, State: TargetUp}
+	if up {
+		log.Printf("targets: %s is reachable again, answering its names locally", ip)
+	} else {
+		ev.State = TargetDown
+		ev.Error = err.Error()
+		log.Printf("targets: %s is unreachable, forwarding its names upstream: %v", ip, err)
+	}
+	t.store.Events().Publish(ev)
+}
+
+// Healthy reports whether ip may be answered locally. IPs that have not been
+// probed yet are healthy.
+func (t *TargetProber) Healthy(ip string) bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.targets[ip]
+	return !ok || s.up()
+}
+
+// Status returns the state of all probed IPs, sorted by IP.
+func (t *TargetProber) Status() []TargetStatus {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := make([]TargetStatus, 0, len(t.targets))
+	for ip, s := range t.targets {
+		st := TargetStatus{
+			IP:          ip,
+			State:       TargetUp,
+			Since:       s.since.UTC().Format(time.RFC3339),
+			Transitions: s.transitions,
+			LastError:   s.lastError,
+		}
+		if !s.up() {
+			st.State = TargetDown
+		}
+		status = append(status, st)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].IP < status[j].IP })
+	return status
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// freePort returns a local TCP port nothing listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestTargetProber_TCPTransitions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	store := NewRecordStore()
+	store.Update(map[string]string{"app.example.com.": "127.0.0.1"})
+	events, cancel := store.Events().Subscribe(10)
+	defer cancel()
+
+	// The first port is closed; the second one makes the target reachable.
+	tp := NewTargetProber(store, TargetProbeTCP, []int{freePort(t), port}, "", time.Minute, time.Second)
+	tp.ProbeAll(context.Background())
+	if st := tp.Status(); len(st) != 1 || st[0].State != TargetUp || !tp.Healthy("127.0.0.1") {
+		t.Fatalf("expected the target to be up, got %+v", st)
+	}
+
+	l.Close()
+	tp.ProbeAll(context.Background())
+	if !tp.Healthy("127.0.0.1") {
+		t.Fatal("expected a single failed probe not to mark the target down")
+	}
+	tp.ProbeAll(context.Background())
+	st := tp.Status()
+	if tp.Healthy("127.0.0.1") || st[0].State != TargetDown || st[0].Transitions != 1 || st[0].LastError == "" {
+		t.Errorf("expected the target to be down, got %+v", st)
+	}
+
+	var ev Event
+	for ev = range events {
+		if ev.Type == EventTarget {
+			break
+		}
+	}
+	if ev.Target != "127.0.0.1" || ev.State != TargetDown {
+		t.Errorf("unexpected target event %+v", ev)
+	}
+
+	// IPs no longer served are forgotten.
+	store.Update(map[string]string{"app.example.com.": "127.0.0.2"})
+	tp.ports = []int{freePort(t)}
+	tp.ProbeAll(context.Background())
+	if st := tp.Status(); len(st) != 1 || st[0].IP != "127.0.0.2" {
+		t.Errorf("expected only the new IP to be tracked, got %+v", st)
+	}
+}
+
+func TestTargetProber_SkipsDirectTargets(t *testing.T) {
+	store := NewRecordStore()
+	store.UpdateSource("pangolin", 0, 1, []Record{
+		{Name: "app.example.com.", IP: "127.0.0.1", IPs: []string{"127.0.0.1", "127.0.0.2"}, Meta: map[string]string{"direct": "targets"}},
+	})
+
+	tp := NewTargetProber(store, TargetProbeTCP, []int{freePort(t)}, "", time.Minute, time.Second)
+	for i := 0; i < 2; i++ {
+		tp.ProbeAll(context.Background())
+	}
+	if st := tp.Status(); len(st) != 0 || !tp.Healthy("127.0.0.1") {
+		t.Errorf("expected direct targets not to be probed, got %+v", st)
+	}
+}
+
+func TestTargetProber_HTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r) // any response counts as reachable
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	store := NewRecordStore()
+	store.Update(map[string]string{"app.example.com.": "127.0.0.1"})
+	tp := NewTargetProber(store, TargetProbeHTTP, nil, "http://{ip}:"+port+"/", time.Minute, time.Second)
+	tp.ProbeAll(context.Background())
+	tp.ProbeAll(context.Background())
+	if !tp.Healthy("127.0.0.1") {
+		t.Errorf("expected the target to be up, got %+v", tp.Status())
+	}
+
+	tp.url = "http://{ip}:" + strconv.Itoa(freePort(t)) + "/"
+	tp.ProbeAll(context.Background())
+	tp.ProbeAll(context.Background())
+	if tp.Healthy("127.0.0.1") {
+		t.Errorf("expected the target to be down, got %+v", tp.Status())
+	}
+}
+
+func TestDNSServer_ForwardsNamesOfUnreachableTargets(t *testing.T) {
+	var rcode atomic.Int32
+	upstream := startTestUpstream(t, &rcode)
+
+	srv := newTestDNSServer(map[string]string{"app.example.com.": "127.0.0.1"})
+	srv.cfg.UpstreamDNS = upstream
+	tp := NewTargetProber(srv.store, TargetProbeTCP, []int{freePort(t)}, "", time.Minute, time.Second)
+	srv.UseTargets(tp)
+
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("app.example.com", dns.TypeA))
+	if a, ok := w.msg.Answer[0].(*dns.A); !ok || a.A.String() != "127.0.0.1" {
+		t.Fatalf("expected the local answer before probing, got %v", w.msg.Answer)
+	}
+
+	for i := 0; i < targetUnhealthyAfter; i++ {
+		tp.ProbeAll(context.Background())
+	}
+	w = &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("app.example.com", dns.TypeA))
+	if a, ok := w.msg.Answer[0].(*dns.A); !ok || a.A.String() != "192.0.2.1" {
+		t.Errorf("expected the upstream answer for an unreachable target, got %v", w.msg.Answer)
+	}
+}
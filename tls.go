@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often certificate files are checked for changes
+// during TLS handshakes.
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves the admin and health server's TLS certificate and
+// client CA bundle, re-reading them when the files change or on Reload, so
+// that renewed certificates are picked up without a restart.
+type CertReloader struct {
+	certFile, keyFile, caFile string
+	checkEvery                time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool // nil unless client certificates are verified
+	modTime   time.Time      // latest modification time of the loaded files
+	checked   time.Time      // last time the files were checked for changes
+}
+
+// NewCertReloader loads the certificate and key and, if caFile is not empty,
+// the CA bundle client certificates are verified against.
+func NewCertReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile, caFile: caFile, checkEvery: certCheckInterval}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload re-reads all files. On error the previously loaded certificate
+// stays in use.
+func (c *CertReloader) Reload() error {
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA bundle %s", c.caFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.clientCAs = pool
+	c.modTime = modTime
+	c.checked = time.Now()
+	return nil
+}
+
+// filesModTime returns the latest modification time of the files.
+func (c *CertReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile, c.caFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reloadIfChanged reloads the files if they changed since they were loaded,
+// checking at most once per checkEvery.
+func (c *CertReloader) reloadIfChanged() {
+	c.mu.Lock()
+	if time.Since(c.checked) < c.checkEvery {
+		c.mu.Unlock()
+		return
+	}
+	c.checked = time.Now()
+	loaded := c.modTime
+	c.mu.Unlock()
+
+	modTime, err := c.filesModTime()
+	if err != nil || !modTime.After(loaded) {
+		return
+	}
+	if err := c.Reload(); err != nil {
+		log.Printf("tls: reloading certificates failed, keeping the previous ones: %v", err)
+		return
+	}
+	log.Printf("tls: reloaded certificates")
+}
+
+// VerifiesClients reports whether client certificates are verified.
+func (c *CertReloader) VerifiesClients() bool {
+	return c.caFile != ""
+}
+
+// TLSConfig returns a server configuration using the current certificate and
+// client CA bundle for every handshake. Client certificates are optional at
+// the TLS layer so that /healthz stays reachable; handlers requiring them
+// check the verified chains.
+func (c *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.reloadIfChanged()
+
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+			}
+			if c.clientCAs != nil {
+				cfg.ClientCAs = c.clientCAs
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return cfg, nil
+		},
+	}
+}
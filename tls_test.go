@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key, signed by a parent or itself.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, serial int64, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "pangolin-dns test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// write stores the certificate and key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// newTLSTestServer serves the admin API of h over TLS with certs.
+func newTLSTestServer(t *testing.T, h *HealthServer, certs *CertReloader) *httptest.Server {
+	t.Helper()
+	h.UseTLS(certs)
+	_, admin := h.routes()
+	srv := httptest.NewUnstartedServer(admin)
+	srv.TLS = certs.TLSConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func tlsClient(ca *testCert, clientCert *testCert) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{clientCert.tlsCert()}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+}
+
+func TestTLS_ClientCertificateRequiredForAdminAPI(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, true)
+	certFile, keyFile := newTestCert(t, 2, ca, false).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	certs, err := NewCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := newTestConfig("")
+	cfg.HealthAnonymous = true
+	srv := newTLSTestServer(t, NewHealthServer(cfg, nil, NewRecordStore()), certs)
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		path   string
+		want   int
+	}{
+		{"no client cert, healthz", tlsClient(ca, nil), "/healthz", http.StatusOK},
+		{"no client cert, domains", tlsClient(ca, nil), "/domains", http.StatusUnauthorized},
+		{"untrusted client cert", tlsClient(ca, newTestCert(t, 3, nil, false)), "/domains", -1},
+		{"client cert, domains", tlsClient(ca, newTestCert(t, 4, ca, false)), "/domains", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, err := tt.client.Get(srv.URL + tt.path)
+		if tt.want == -1 {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("%s: expected the handshake to fail", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestTLS_ReloadsChangedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, true)
+	certFile, keyFile := newTestCert(t, 10, ca, false).write(t, dir, "server")
+
+	certs, err := NewCertReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	certs.checkEvery = 0
+	srv := newTLSTestServer(t, NewHealthServer(newTestConfig(""), nil, NewRecordStore()), certs)
+
+	serial := func() int64 {
+		t.Helper()
+		client := tlsClient(ca, nil)
+		client.Transport.(*http.Transport).DisableKeepAlives = true
+		resp, err := client.Get(srv.URL + "/healthz")
+		if err != nil {
+			t.Fatalf("GET /healthz: %v", err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+	if s := serial(); s != 10 {
+		t.Fatalf("expected serial 10, got %d", s)
+	}
+
+	newTestCert(t, 11, ca, false).write(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if s := serial(); s != 11 {
+		t.Errorf("expected the renewed certificate (serial 11), got %d", s)
+	}
+
+	// A broken certificate keeps the previous one in use.
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+	future = future.Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if s := serial(); s != 11 {
+		t.Errorf("expected the previous certificate to stay in use, got %d", s)
+	}
+	if err := certs.Reload(); err == nil {
+		t.Error("expected Reload to fail for an invalid certificate")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TraefikSource discovers router hostnames via the Traefik API and maps them
+// to a configured local IP.
+type TraefikSource struct {
+	apiURL  string
+	localIP string
+	client  *http.Client
+}
+
+// traefikRouter is the subset of a router returned by /api/{http,tcp}/routers.
+type traefikRouter struct {
+	Name     string `json:"name"`
+	Rule     string `json:"rule"`
+	Status   string `json:"status"`
+	Provider string `json:"provider"`
+	Service  string `json:"service"`
+}
+
+var (
+	// traefikHostMatcher matches Host(...) and HostSNI(...) calls in a router rule.
+	traefikHostMatcher = regexp.MustCompile("\\b(?:Host|HostSNI)\\(([^)]*)\\)")
+	// traefikHostArg matches a single backtick- or double-quoted argument.
+	traefikHostArg = regexp.MustCompile("`([^`]*)`|\"([^\"]*)\"")
+)
+
+func NewTraefikSource(apiURL, localIP string) *TraefikSource {
+	return &TraefikSource{
+		apiURL:  strings.TrimRight(apiURL, "/"),
+		localIP: localIP,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (t *TraefikSource) Name() string { return "traefik" }
+
+// Fetch returns one record per hostname found in the rules of enabled HTTP
+// and TCP routers.
+func (t *TraefikSource) Fetch(ctx context.Context) ([]Record, error) {
+	records := make([]Record, 0)
+	seen := make(map[string]bool)
+
+	for _, kind := range []string{"http", "tcp"} {
+		routers, err := t.getRouters(ctx, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range routers {
+			if r.Status != "" && r.Status != "enabled" {
+				continue
+			}
+			for _, host := range parseTraefikRule(r.Rule) {
+				if seen[host] {
+					continue
+				}
+				seen[host] = true
+				records = append(records, Record{
+					Name: host,
+					IP:   t.localIP,
+					Meta: map[string]string{"router": r.Name, "service": r.Service},
+				})
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// getRouters fetches all routers of the given kind ("http" or "tcp"),
+// following Traefik's X-Next-Page pagination header.
+func (t *TraefikSource) getRouters(ctx context.Context, kind string) ([]traefikRouter, error) {
+	var all []traefikRouter
+	page := "1"
+
+	for page != "" {
+		path := fmt.Sprintf("/api/%s/routers?page=%s&per_page=100", kind, page)
+		req, err := http.NewRequestWithContext(ctx, "GET", t.apiURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %w", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: read body: %w", path, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %w", path, &httpStatusError{StatusCode: resp.StatusCode, Body: string(body)})
+		}
+
+		var routers []traefikRouter
+		if err := json.Unmarshal(body, &routers); err != nil {
+			return nil, fmt.Errorf("parse %s routers: %w", kind, err)
+		}
+		all = append(all, routers...)
+
+		next := resp.Header.Get("X-Next-Page")
+		if next == page || next == "1" {
+			break
+		}
+		page = next
+	}
+
+	return all, nil
+}
+
+// parseTraefikRule extracts the hostnames from all Host(...) and HostSNI(...)
+// matchers of a router rule. Wildcard SNI matchers are skipped.
+func parseTraefikRule(rule string) []string {
+	var hosts []string
+	for _, m := range traefikHostMatcher.FindAllStringSubmatch(rule, -1) {
+		for _, arg := range traefikHostArg.FindAllStringSubmatch(m[1], -1) {
+			host := arg[1] + arg[2]
+			if host == "" || strings.Contains(host, "*") {
+				continue
+			}
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseTraefikRule(t *testing.T) {
+	cases := []struct {
+		rule string
+		want []string
+	}{
+		{"Host(`app.example.com`)", []string{"app.example.com"}},
+		{"Host(`a.example.com`, `b.example.com`)", []string{"a.example.com", "b.example.com"}},
+		{"Host(`a.example.com`) || (Host(\"b.example.com\") && PathPrefix(`/api`))", []string{"a.example.com", "b.example.com"}},
+		{"HostSNI(`db.example.com`)", []string{"db.example.com"}},
+		{"HostSNI(`*`)", nil},
+		{"PathPrefix(`/`)", nil},
+		{"HostRegexp(`{sub:[a-z]+}.example.com`)", nil},
+	}
+
+	for _, c := range cases {
+		if got := parseTraefikRule(c.rule); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseTraefikRule(%q) = %v, want %v", c.rule, got, c.want)
+		}
+	}
+}
+
+func TestTraefikSource_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/http/routers":
+			if r.URL.Query().Get("page") == "1" {
+				w.Header().Set("X-Next-Page", "2")
+				json.NewEncoder(w).Encode([]traefikRouter{
+					{Name: "app@docker", Rule: "Host(`app.example.com`)", Status: "enabled"},
+					{Name: "off@docker", Rule: "Host(`off.example.com`)", Status: "disabled"},
+				})
+				return
+			}
+			w.Header().Set("X-Next-Page", "1")
+			json.NewEncoder(w).Encode([]traefikRouter{
+				{Name: "dup@file", Rule: "Host(`app.example.com`)", Status: "enabled"},
+				{Name: "wiki@file", Rule: "Host(`wiki.example.com`)", Status: "enabled"},
+			})
+		case "/api/tcp/routers":
+			json.NewEncoder(w).Encode([]traefikRouter{
+				{Name: "db@file", Rule: "HostSNI(`db.example.com`)", Status: "enabled"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	records, err := NewTraefikSource(srv.URL, "10.0.0.7").Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, r := range records {
+		got[r.Name] = r.IP
+	}
+	want := map[string]string{
+		"app.example.com":  "10.0.0.7",
+		"wiki.example.com": "10.0.0.7",
+		"db.example.com":   "10.0.0.7",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got records %v, want %v", got, want)
+	}
+}
+
+func TestTraefikSource_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	records, err := NewTraefikSource(srv.URL, "10.0.0.7").Fetch(context.Background())
+	if err == nil {
+		t.Fatal("expected error for non-200 response")
+	}
+	if records != nil {
+		t.Error("failed fetch must return nil records so previous ones are kept")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// upstreamUnhealthyAfter is the number of consecutive failed probes after
+// which an upstream is considered unhealthy.
+const upstreamUnhealthyAfter = 3
+
+// upstreamProbeWindow is the number of recent probes the success rate and
+// average latency are computed over.
+const upstreamProbeWindow = 20
+
+// splitUpstreams parses a comma-separated list of upstream DNS servers.
+func splitUpstreams(s string) []string {
+	var upstreams []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			upstreams = append(upstreams, u)
+		}
+	}
+	return upstreams
+}
+
+// UpstreamProber periodically sends a synthetic query to each upstream DNS
+// server and tracks its success rate and latency. Upstreams failing
+// upstreamUnhealthyAfter probes in a row are reported unhealthy until a probe
+// succeeds again.
+type UpstreamProber struct {
+	upstreams []string
+	query     string // name queried for its NS records
+	interval  time.Duration
+	timeout   time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*upstreamStats
+}
+
+// upstreamStats holds the probe history of one upstream.
+type upstreamStats struct {
+	results   []probeResult // ring buffer of the last upstreamProbeWindow probes
+	next      int
+	probes    int64
+	failures  int64
+	streak    int // consecutive failed probes
+	lastProbe time.Time
+	lastError string
+}
+
+type probeResult struct {
+	ok      bool
+	latency time.Duration
+}
+
+// UpstreamStatus reports the probe state of one upstream.
+type UpstreamStatus struct {
+	Address     string  `json:"address"`
+	Healthy     bool    `json:"healthy"`
+	SuccessRate float64 `json:"success_rate"` // over the recent probes, 0..1
+	LatencyMS   float64 `json:"latency_ms"`   // average of the recent successful probes
+	Probes      int64   `json:"probes"`
+	Failures    int64   `json:"failures"`
+	LastProbe   string  `json:"last_probe,omitempty"`
+	LastError   string  `json:"last_error,omitempty"`
+}
+
+func NewUpstreamProber(upstreams []string, query string, interval, timeout time.Duration) *UpstreamProber {
+	u := &UpstreamProber{
+		upstreams: upstreams,
+		query:     dns.Fqdn(query),
+		interval:  interval,
+		timeout:   timeout,
+		stats:     make(map[string]*upstreamStats),
+	}
+	for _, addr := range upstreams {
+		u.stats[addr] = &upstreamStats{}
+	}
+	return u
+}
+
+// Run probes all upstreams immediately, then every interval until ctx is
+// cancelled.
+func (u *UpstreamProber) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		u.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes all upstreams in parallel and records the results.
+func (u *UpstreamProber) ProbeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, addr := range u.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := u.probe(ctx, addr)
+			if ctx.Err() != nil {
+				return
+			}
+			u.record(addr, latency, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// probe sends a single synthetic query. Any answer other than SERVFAIL or
+// REFUSED counts as success.
+func (u *UpstreamProber) probe(ctx context.Context, addr string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	m := new(dns.Msg)
+	m.SetQuestion(u.query, dns.TypeNS)
+	client := &dns.Client{Timeout: u.timeout}
+	resp, rtt, err := client.ExchangeContext(ctx, m, addr)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Rcode == dns.RcodeServerFailure || resp.Rcode == dns.RcodeRefused {
+		return 0, &rcodeError{rcode: resp.Rcode}
+	}
+	return rtt, nil
+}
+
+type rcodeError struct{ rcode int }
+
+func (e *rcodeError) Error() string { return "upstream answered " + dns.RcodeToString[e.rcode] }
+
+// record adds a probe result and logs health transitions.
+func (u *UpstreamProber) record(addr string, latency time.Duration, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s := u.stats[addr]
+
+	wasHealthy := s.streak < upstreamUnhealthyAfter
+	res := probeResult{ok: err == nil, latency: latency}
+	if len(s.results) < upstreamProbeWindow {
+		s.results = append(s.results, res)
+	} else {
+		s.results[s.next] = res
+	}
+	s.next = (s.next + 1) % upstreamProbeWindow
+	s.probes++
+	s.lastProbe = time.Now()
+
+	if err != nil {
+		s.failures++
+		s.streak++
+		s.lastError = err.Error()
+	} else {
+		s.streak = 0
+		s.lastError = ""
+	}
+
+	switch healthy := s.streak < upstreamUnhealthyAfter; {
+	case wasHealthy && !healthy:
+		log.Printf("upstream: %s is unhealthy after %d failed probes: %v", addr, s.streak, err)
+	case !wasHealthy && healthy:
+		log.Printf("upstream: %s is healthy again", addr)
+	}
+}
+
+// Healthy reports whether addr is considered healthy. Upstreams that are not
+// probed are always healthy.
+func (u *UpstreamProber) Healthy(addr string) bool {
+	if u == nil {
+		return true
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s, ok := u.stats[addr]
+	return !ok || s.streak < upstreamUnhealthyAfter
+}
+
+// Status returns the probe state of all upstreams, in configuration order.
+func (u *UpstreamProber) Status() []UpstreamStatus {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	status := make([]UpstreamStatus, 0, len(u.upstreams))
+	for _, addr := range u.upstreams {
+		s := u.stats[addr]
+		st := UpstreamStatus{
+			Address:   addr,
+			Healthy:   s.streak < upstreamUnhealthyAfter,
+			Probes:    s.probes,
+			Failures:  s.failures,
+			LastError: s.lastError,
+		}
+		if !s.lastProbe.IsZero() {
+			st.LastProbe = s.lastProbe.UTC().Format(time.RFC3339)
+		}
+
+		var ok int
+		var total time.Duration
+		for _, r := range s.results {
+			if r.ok {
+				ok++
+				total += r.latency
+			}
+		}
+		if len(s.results) > 0 {
+			st.SuccessRate = float64(ok) / float64(len(s.results))
+		}
+		if ok > 0 {
+			st.LatencyMS = float64(total.Microseconds()) / float64(ok) / 1000
+		}
+		status = append(status, st)
+	}
+	return status
+}
+
+// orderedUpstreams returns the upstreams to try for a query: healthy ones
+// first, in configuration order, followed by unhealthy ones as a last resort.
+func (u *UpstreamProber) orderedUpstreams(upstreams []string) []string {
+	if u == nil {
+		return upstreams
+	}
+	ordered := make([]string, 0, len(upstreams))
+	var unhealthy []string
+	for _, addr := range upstreams {
+		if u.Healthy(addr) {
+			ordered = append(ordered, addr)
+		} else {
+			unhealthy = append(unhealthy, addr)
+		}
+	}
+	return append(ordered, unhealthy...)
+}
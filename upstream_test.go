@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTestUpstream runs a DNS server on a random local UDP port answering
+// every query with rcode, and returns its address.
+func startTestUpstream(t *testing.T, rcode *atomic.Int32) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, int(rcode.Load()))
+		if rcode.Load() == dns.RcodeSuccess && len(r.Question) > 0 && r.Question[0].Qtype == dns.TypeA {
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})}
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestUpstreamProber_TracksHealth(t *testing.T) {
+	var rcode atomic.Int32
+	addr := startTestUpstream(t, &rcode)
+	u := NewUpstreamProber([]string{addr}, ".", time.Minute, time.Second)
+
+	u.ProbeAll(context.Background())
+	st := u.Status()[0]
+	if !st.Healthy || st.SuccessRate != 1 || st.Probes != 1 || st.LatencyMS <= 0 {
+		t.Errorf("unexpected status after a successful probe: %+v", st)
+	}
+
+	rcode.Store(dns.RcodeServerFailure)
+	for i := 0; i < upstreamUnhealthyAfter; i++ {
+		if !u.Healthy(addr) {
+			t.Fatalf("unhealthy after only %d failed probes", i)
+		}
+		u.ProbeAll(context.Background())
+	}
+	st = u.Status()[0]
+	if st.Healthy || st.Failures != 3 || st.SuccessRate != 0.25 || !strings.Contains(st.LastError, "SERVFAIL") {
+		t.Errorf("unexpected status after failed probes: %+v", st)
+	}
+
+	rcode.Store(dns.RcodeSuccess)
+	u.ProbeAll(context.Background())
+	if !u.Healthy(addr) {
+		t.Error("expected the upstream to recover after a successful probe")
+	}
+}
+
+func TestDNSServer_ForwardPrefersHealthyUpstream(t *testing.T) {
+	var good atomic.Int32
+	goodAddr := startTestUpstream(t, &good)
+
+	// A dead upstream listed first is skipped once the prober reports it down.
+	dead := "127.0.0.1:1"
+	srv := newTestDNSServer(nil)
+	srv.cfg.UpstreamDNS = dead + "," + goodAddr
+	prober := NewUpstreamProber([]string{dead, goodAddr}, ".", time.Minute, 100*time.Millisecond)
+	for i := 0; i < upstreamUnhealthyAfter; i++ {
+		prober.ProbeAll(context.Background())
+	}
+	srv.UseProber(prober)
+
+	if got := prober.orderedUpstreams([]string{dead, goodAddr}); got[0] != goodAddr {
+		t.Errorf("expected the healthy upstream first, got %v", got)
+	}
+
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("example.org", dns.TypeA))
+	if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 1 {
+		t.Errorf("expected the answer of the healthy upstream, got %v", w.msg)
+	}
+}
+
+func TestDNSServer_ForwardFallsBackToNextUpstream(t *testing.T) {
+	var good atomic.Int32
+	goodAddr := startTestUpstream(t, &good)
+
+	srv := newTestDNSServer(nil)
+	srv.cfg.UpstreamDNS = "127.0.0.1:1, " + goodAddr
+	w := &dnsRecorder{}
+	srv.ServeDNS(w, makeQuery("example.org", dns.TypeA))
+	if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("expected the second upstream to answer, got %v", w.msg)
+	}
+}
+
+func TestHealthServer_UpstreamsInHealthAndMetrics(t *testing.T) {
+	var rcode atomic.Int32
+	rcode.Store(dns.RcodeRefused)
+	addr := startTestUpstream(t, &rcode)
+	prober := NewUpstreamProber([]string{addr}, ".", time.Minute, time.Second)
+	for i := 0; i < upstreamUnhealthyAfter; i++ {
+		prober.ProbeAll(context.Background())
+	}
+
+	h := NewHealthServer(newTestConfig(""), nil, NewRecordStore())
+	h.UseProber(prober)
+
+	resp := h.health()
+	if resp.Status != StatusDegraded || len(resp.Upstreams) != 1 || resp.Upstreams[0].Healthy {
+		t.Errorf("expected a degraded status with the unhealthy upstream, got %+v", resp)
+	}
+	if c := resp.Checks[len(resp.Checks)-1]; c.Name != "upstream:"+addr || c.Status != CheckDown {
+		t.Errorf("unexpected upstream check %+v", c)
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`pangolin_dns_upstream_healthy{upstream="` + addr + `"} 0`,
+		`pangolin_dns_upstream_probe_failures_total{upstream="` + addr + `"} 3`,
+		"pangolin_dns_records 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook payload formats.
+const (
+	WebhookJSON    = "json"
+	WebhookSlack   = "slack"
+	WebhookDiscord = "discord"
+	WebhookNtfy    = "ntfy"
+)
+
+// Notification types sent to webhooks.
+const (
+	NotifyChanges      = "changes"
+	NotifyPollFailing  = "poll_failing"
+	NotifyPollRecovery = "poll_recovered"
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// prefixed with "sha256=", when the webhook has a secret.
+const webhookSignatureHeader = "X-Pangolin-DNS-Signature"
+
+// maxChangeLines bounds the number of changes listed in chat messages.
+const maxChangeLines = 20
+
+// WebhookConfig configures one outgoing webhook.
+type WebhookConfig struct {
+	Name   string
+	URL    Secret // may embed a token, as for Slack and Discord
+	Format string // WebhookJSON, WebhookSlack, WebhookDiscord or WebhookNtfy
+	Secret Secret // optional HMAC-SHA256 signing key
+}
+
+// Notification is the payload of the generic JSON webhook format.
+type Notification struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Changes  []Change  `json:"changes,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Failures int64     `json:"failures,omitempty"`
+}
+
+// WebhookNotifier sends record changes and poll failure streaks of the
+// EventBus to a webhook. A failure notification is sent once a source has
+// failed failureThreshold polls in a row, and a recovery notification with
+// its next successful poll.
+type WebhookNotifier struct {
+	hook             WebhookConfig
+	events           *EventBus
+	failureThreshold int64
+	retry            RetryPolicy
+	client           *http.Client
+
+	failing map[string]bool // sources a failure notification was sent for
+}
+
+func NewWebhookNotifier(hook WebhookConfig, events *EventBus, failureThreshold int, retry RetryPolicy) *WebhookNotifier {
+	return &WebhookNotifier{
+		hook:             hook,
+		events:           events,
+		failureThreshold: int64(failureThreshold),
+		retry:            retry,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		failing: make(map[string]bool),
+	}
+}
+
+// Run delivers notifications until ctx is cancelled.
+func (n *WebhookNotifier) Run(ctx context.Context) {
+	events, cancel := n.events.Subscribe(100)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			note, ok := n.notification(ev)
+			if !ok {
+				continue
+			}
+			if err := n.Send(ctx, note); err != nil && ctx.Err() == nil {
+				log.Printf("webhook: %s: %s notification failed: %v", n.hook.Name, note.Type, err)
+			}
+		}
+	}
+}
+
+// notification turns an event into a notification, reporting false if the
+// event is not worth notifying about.
+func (n *WebhookNotifier) notification(ev Event) (Notification, bool) {
+	note := Notification{Time: ev.Time, Source: ev.Source}
+
+	switch ev.Type {
+	case EventChanges:
+		// The first records of a source after a restart are the whole zone,
+		// not news.
+		if ev.Initial {
+			return note, false
+		}
+		note.Type = NotifyChanges
+		note.Changes = ev.Changes
+		return note, true
+
+	case EventPoll:
+		if ev.Error != "" {
+			if n.failureThreshold <= 0 || ev.Failures != n.failureThreshold {
+				return note, false
+			}
+			n.failing[ev.Source] = true
+			note.Type = NotifyPollFailing
+			note.Error = ev.Error
+			note.Failures = ev.Failures
+			return note, true
+		}
+		if n.failing[ev.Source] {
+			delete(n.failing, ev.Source)
+			note.Type = NotifyPollRecovery
+			return note, true
+		}
+	}
+	return note, false
+}
+
+// Send delivers a notification, retrying transient failures.
+func (n *WebhookNotifier) Send(ctx context.Context, note Notification) error {
+	body, contentType, headers, err := n.payload(note)
+	if err != nil {
+		return err
+	}
+
+	return n.retry.Do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "POST", n.hook.URL.Value(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if n.hook.Secret.IsSet() {
+			req.Header.Set(webhookSignatureHeader, "sha256="+signPayload(n.hook.Secret.Value(), body))
+		}
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &httpStatusError{StatusCode: resp.StatusCode}
+		}
+		return nil
+	})
+}
+
+// payload renders a notification in the webhook's format.
+func (n *WebhookNotifier) payload(note Notification) (body []byte, contentType string, headers map[string]string, err error) {
+	switch n.hook.Format {
+	case WebhookSlack:
+		body, err = json.Marshal(map[string]string{"text": notificationText(note)})
+		return body, "application/json", nil, err
+	case WebhookDiscord:
+		body, err = json.Marshal(map[string]string{"content": notificationText(note)})
+		return body, "application/json", nil, err
+	case WebhookNtfy:
+		headers = map[string]string{"Title": notificationTitle(note), "Tags": "globe_with_meridians"}
+		if note.Type == NotifyPollFailing {
+			headers["Priority"] = "high"
+			headers["Tags"] = "warning"
+		}
+		return []byte(notificationBody(note)), "text/plain; charset=utf-8", headers, nil
+	default:
+		body, err = json.Marshal(note)
+		return body, "application/json", nil, err
+	}
+}
+
+// signPayload returns the hex HMAC-SHA256 of body keyed with secret.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func notificationTitle(note Notification) string {
+	switch note.Type {
+	case NotifyChanges:
+		return fmt.Sprintf("pangolin-dns: %d record change(s) from %s", len(note.Changes), sourceLabel(note.Source))
+	case NotifyPollFailing:
+		return fmt.Sprintf("pangolin-dns: %s failed %d polls in a row", sourceLabel(note.Source), note.Failures)
+	case NotifyPollRecovery:
+		return fmt.Sprintf("pangolin-dns: %s recovered", sourceLabel(note.Source))
+	}
+	return "pangolin-dns: " + note.Type
+}
+
+func notificationBody(note Notification) string {
+	switch note.Type {
+	case NotifyChanges:
+		var b strings.Builder
+		for i, c := range note.Changes {
+			if i == maxChangeLines {
+				fmt.Fprintf(&b, "… and %d more\n", len(note.Changes)-maxChangeLines)
+				break
+			}
+			switch c.Type {
+			case ChangeAdded:
+				fmt.Fprintf(&b, "+ %s -> %s\n", c.Name, c.IP)
+			case ChangeRemoved:
+				fmt.Fprintf(&b, "- %s\n", c.Name)
+			case ChangeChanged:
+				fmt.Fprintf(&b, "~ %s -> %s (was %s)\n", c.Name, c.IP, c.OldIP)
+			}
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	case NotifyPollFailing:
+		return "Last error: " + note.Error
+	case NotifyPollRecovery:
+		return "Polling succeeded again."
+	}
+	return ""
+}
+
+func notificationText(note Notification) string {
+	return notificationTitle(note) + "\n" + notificationBody(note)
+}
+
+func sourceLabel(source string) string {
+	if source == "" {
+		return "manual update"
+	}
+	return source
+}
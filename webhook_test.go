@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookRequest is a request received by a test webhook server.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhookServer returns a server recording requests, answering the first
+// failures requests with 503.
+func newWebhookServer(t *testing.T, failures int32) (*httptest.Server, chan webhookRequest) {
+	reqs := make(chan webhookRequest, 10)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reqs <- webhookRequest{header: r.Header, body: body}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs
+}
+
+var testChanges = Notification{
+	Type:   NotifyChanges,
+	Source: "pangolin",
+	Changes: []Change{
+		{Type: ChangeAdded, Name: "app.example.com.", IP: "10.0.0.1"},
+		{Type: ChangeRemoved, Name: "old.example.com.", IP: "10.0.0.2"},
+	},
+}
+
+func TestWebhook_JSONSignedPayload(t *testing.T) {
+	srv, reqs := newWebhookServer(t, 0)
+	n := NewWebhookNotifier(WebhookConfig{Name: "ops", URL: NewSecret(srv.URL), Format: WebhookJSON, Secret: NewSecret("s3cret")}, NewEventBus(), 3, RetryPolicy{Attempts: 1})
+
+	if err := n.Send(context.Background(), testChanges); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := <-reqs
+
+	var got Notification
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatalf("invalid JSON payload: %v", err)
+	}
+	if got.Type != NotifyChanges || got.Source != "pangolin" || len(got.Changes) != 2 {
+		t.Errorf("unexpected payload %+v", got)
+	}
+	if sig := req.header.Get(webhookSignatureHeader); sig != "sha256="+signPayload("s3cret", req.body) {
+		t.Errorf("unexpected signature %q", sig)
+	}
+}
+
+func TestWebhook_ChatFormats(t *testing.T) {
+	for format, field := range map[string]string{WebhookSlack: "text", WebhookDiscord: "content"} {
+		srv, reqs := newWebhookServer(t, 0)
+		n := NewWebhookNotifier(WebhookConfig{Name: format, URL: NewSecret(srv.URL), Format: format}, NewEventBus(), 3, RetryPolicy{Attempts: 1})
+		if err := n.Send(context.Background(), testChanges); err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		req := <-reqs
+
+		var got map[string]string
+		if err := json.Unmarshal(req.body, &got); err != nil {
+			t.Fatalf("%s: invalid JSON payload: %v", format, err)
+		}
+		text := got[field]
+		if !strings.Contains(text, "2 record change(s) from pangolin") || !strings.Contains(text, "+ app.example.com. -> 10.0.0.1") {
+			t.Errorf("%s: unexpected %s %q", format, field, text)
+		}
+		if req.header.Get(webhookSignatureHeader) != "" {
+			t.Errorf("%s: expected no signature without a secret", format)
+		}
+	}
+}
+
+func TestWebhook_Ntfy(t *testing.T) {
+	srv, reqs := newWebhookServer(t, 0)
+	n := NewWebhookNotifier(WebhookConfig{Name: "phone", URL: NewSecret(srv.URL), Format: WebhookNtfy}, NewEventBus(), 3, RetryPolicy{Attempts: 1})
+	note := Notification{Type: NotifyPollFailing, Source: "docker", Error: "connection refused", Failures: 3}
+	if err := n.Send(context.Background(), note); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := <-reqs
+
+	if title := req.header.Get("Title"); title != "pangolin-dns: docker failed 3 polls in a row" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if req.header.Get("Priority") != "high" {
+		t.Errorf("expected high priority for failures, got %q", req.header.Get("Priority"))
+	}
+	if string(req.body) != "Last error: connection refused" {
+		t.Errorf("unexpected body %q", req.body)
+	}
+}
+
+func TestWebhook_RetriesServerErrors(t *testing.T) {
+	srv, reqs := newWebhookServer(t, 2)
+	n := NewWebhookNotifier(WebhookConfig{Name: "ops", URL: NewSecret(srv.URL)}, NewEventBus(), 3, RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond})
+	if err := n.Send(context.Background(), testChanges); err != nil {
+		t.Fatalf("expected delivery after retries, got %v", err)
+	}
+	<-reqs
+}
+
+func TestWebhook_FailureStreakAndRecovery(t *testing.T) {
+	n := NewWebhookNotifier(WebhookConfig{Name: "ops"}, NewEventBus(), 2, RetryPolicy{})
+
+	var notes []string
+	for _, ev := range []Event{
+		{Type: EventPoll, Source: "docker", Error: "boom", Failures: 1},
+		{Type: EventPoll, Source: "docker", Error: "boom", Failures: 2},
+		{Type: EventPoll, Source: "docker", Error: "boom", Failures: 3},
+		{Type: EventPoll, Source: "traefik"},
+		{Type: EventPoll, Source: "docker"},
+		{Type: EventPoll, Source: "docker"},
+	} {
+		if note, ok := n.notification(ev); ok {
+			notes = append(notes, note.Type+" "+note.Source)
+		}
+	}
+
+	want := []string{NotifyPollFailing + " docker", NotifyPollRecovery + " docker"}
+	if strings.Join(notes, ",") != strings.Join(want, ",") {
+		t.Errorf("expected notifications %v, got %v", want, notes)
+	}
+}
+
+func TestWebhook_SkipsInitialPopulation(t *testing.T) {
+	n := NewWebhookNotifier(WebhookConfig{Name: "ops"}, NewEventBus(), 2, RetryPolicy{})
+	changes := []Change{{Type: ChangeAdded, Name: "app.example.com.", IP: "10.0.0.1"}}
+
+	if _, ok := n.notification(Event{Type: EventChanges, Source: "docker", Changes: changes, Initial: true}); ok {
+		t.Error("expected no notification for the initial records of a source")
+	}
+	if _, ok := n.notification(Event{Type: EventChanges, Source: "docker", Changes: changes}); !ok {
+		t.Error("expected a notification for later changes")
+	}
+}
+
+func TestWebhook_NotifiesStoreChanges(t *testing.T) {
+	srv, reqs := newWebhookServer(t, 0)
+	store := NewRecordStore()
+	n := NewWebhookNotifier(WebhookConfig{Name: "ops", URL: NewSecret(srv.URL)}, store.Events(), 3, RetryPolicy{Attempts: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx)
+		close(done)
+	}()
+
+	// Run subscribes asynchronously; keep updating until the change arrives.
+	var gen uint64
+	for {
+		gen++
+		ip := "10.0.0.1"
+		if gen%2 == 0 {
+			ip = "10.0.0.2"
+		}
+		store.UpdateSource("docker", 50, gen, []Record{{Name: "app.example.com.", IP: ip, Source: "docker"}})
+		select {
+		case req := <-reqs:
+			var got Notification
+			if err := json.Unmarshal(req.body, &got); err != nil {
+				t.Fatalf("invalid JSON payload: %v", err)
+			}
+			if got.Type != NotifyChanges || got.Source != "docker" || len(got.Changes) != 1 {
+				t.Errorf("unexpected payload %+v", got)
+			}
+			cancel()
+			<-done
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}